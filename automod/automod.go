@@ -17,8 +17,33 @@ func KeyViolations(gID, uID, violation string) string {
 	return "automod_words_violations_" + violation + ":" + gID + ":" + uID
 }
 
+// Sorted set of the ids of recent messages with the same fingerprint by a user
+func KeyDuplicateMessages(gID, uID, fingerprint string) string {
+	return "automod_duplicate_messages:" + gID + ":" + uID + ":" + fingerprint
+}
+
+// Sorted set of recent joins by the time they joined, for raid protection
+func KeyRaidJoins(gID string) string { return "automod_raid_joins:" + gID }
+
+// Set while the server is in raid lockdown
+func KeyRaidLockdown(gID string) string { return "automod_raid_lockdown:" + gID }
+
+// The id of the server an invite code leads to, empty for invalid invites
+func KeyInviteGuild(code string) string { return "automod_invite_guild:" + code }
+
+// Where a link on a url shortener leads to
+func KeyShortLink(link string) string { return "automod_short_link:" + link }
+
+// Hash of the custom rules by id
+func KeyCustomRules(gID string) string { return "automod_custom_rules:" + gID }
+
+// Hash of the channel overrides by channel id
+func KeyChannelOverrides(gID string) string { return "automod_channel_overrides:" + gID }
+
 // Local Bot Cache keys
-func KeyAllRules(gID string) string { return "automod_rules:" + gID }
+func KeyAllRules(gID string) string              { return "automod_rules:" + gID }
+func KeyCustomRulesCache(gID string) string      { return "automod_custom_rules_cache:" + gID }
+func KeyChannelOverridesCache(gID string) string { return "automod_channel_overrides_cache:" + gID }
 
 type Plugin struct{}
 
@@ -27,32 +52,60 @@ func RegisterPlugin() {
 
 	web.RegisterPlugin(p)
 	bot.RegisterPlugin(p)
+
+	common.RegisterScheduledEventHandler("automod_raid_end", handleRaidEnd)
+	common.SQL.AutoMigrate(&Violation{})
 }
 
 func (p *Plugin) Name() string { return "Automod" }
 
 type Config struct {
 	Enabled bool
-	Spam    *SpamRule    `valid:"traverse"`
-	Mention *MentionRule `valid:"traverse"`
-	Invite  *InviteRule  `valid:"traverse"`
-	Links   *LinksRule   `valid:"traverse"`
-	Sites   *SitesRule   `valid:"traverse"`
-	Words   *WordsRule   `valid:"traverse"`
+	// Channel to log all triggered rules in, empty to disable
+	LogChannel string `valid:"channel,true"`
+
+	Spam        *SpamRule       `valid:"traverse"`
+	Duplicate   *DuplicateRule  `valid:"traverse"`
+	Mention     *MentionRule    `valid:"traverse"`
+	Invite      *InviteRule     `valid:"traverse"`
+	Links       *LinksRule      `valid:"traverse"`
+	Sites       *SitesRule      `valid:"traverse"`
+	Words       *WordsRule      `valid:"traverse"`
+	Caps        *CapsRule       `valid:"traverse"`
+	Emoji       *EmojiRule      `valid:"traverse"`
+	Zalgo       *ZalgoRule      `valid:"traverse"`
+	CharFlood   *CharFloodRule  `valid:"traverse"`
+	Attachments *AttachmentRule `valid:"traverse"`
+	NewMembers  *NewMemberRule  `valid:"traverse"`
+
+	Raid *RaidProtection `valid:"traverse"`
 }
 
 func (c Config) Name() string {
 	return "Automoderator"
 }
 
+// Rules returns all the message rules, in the order they're checked
+func (c *Config) Rules() []Rule {
+	return []Rule{c.Spam, c.Duplicate, c.Invite, c.Mention, c.Links, c.Words, c.Sites, c.Caps, c.Emoji, c.Zalgo, c.CharFlood, c.Attachments, c.NewMembers}
+}
+
 func NewConfig() *Config {
 	return &Config{
-		Spam:    &SpamRule{},
-		Mention: &MentionRule{},
-		Invite:  &InviteRule{},
-		Links:   &LinksRule{},
-		Sites:   &SitesRule{},
-		Words:   &WordsRule{},
+		Spam:        &SpamRule{},
+		Duplicate:   &DuplicateRule{NumRepeats: 3, Within: 60, MinLength: 3},
+		Mention:     &MentionRule{},
+		Invite:      &InviteRule{},
+		Links:       &LinksRule{},
+		Sites:       &SitesRule{},
+		Words:       &WordsRule{},
+		Caps:        &CapsRule{MinLength: 10, MaxPercentage: 70},
+		Emoji:       &EmojiRule{MaxEmojis: 10},
+		Zalgo:       &ZalgoRule{MaxCombining: 10},
+		CharFlood:   &CharFloodRule{MaxRepeated: 15},
+		Attachments: &AttachmentRule{},
+		NewMembers:  &NewMemberRule{MemberAgeMinutes: 10, BlockLinks: true, BlockInvites: true},
+		Raid:        &RaidProtection{JoinThreshold: 10, JoinsWithin: 10, MaxAccountAgeDays: 7, LockdownDuration: 10},
 	}
 }
 
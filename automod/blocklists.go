@@ -0,0 +1,314 @@
+package automod
+
+// Domain blocklists loaded from local files on top of the builtin lists, these back the bad and porn site options of the sites rule
+//
+// The blocklist directory (YAGPDB_AUTOMOD_BLOCKLISTS, "blocklists" by default) has a folder per list,
+// every .txt file in them is loaded so operators can add their own lists:
+//   bad/        IP loggers, phishing and malware sites
+//   porn/       porn sites
+//   shorteners/ url shorteners, links to these are followed to the site they redirect to
+//   lookalike/  commonly impersonated sites, domains that look like these are treated as bad sites
+//
+// One domain per line, lines starting with # are ignored. Hosts files ("0.0.0.0 example.com") and
+// adblock style domain rules ("||example.com^") also work, so most published lists can be used as is.
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"github.com/Sirupsen/logrus"
+	"github.com/fzzy/radix/redis"
+	"github.com/jonas747/discordgo"
+	"golang.org/x/net/idna"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+const (
+	// Max number of redirects followed for links to url shorteners
+	maxShortenerHops = 5
+	// Max number of short links followed per message
+	maxShortLinksPerMessage = 5
+	// Max time spent following the short links of a message, for all the links and redirects together
+	shortLinkTimeout = time.Second * 5
+	// How long the destinations of short links are cached, in seconds
+	shortLinkCacheValid = 60 * 60 * 24
+)
+
+type Blocklists struct {
+	Bad        map[string]bool
+	Porn       map[string]bool
+	Shorteners map[string]bool
+	// Skeletons of the commonly impersonated domains, see domainSkeleton
+	Lookalikes map[string]string
+}
+
+var (
+	blocklists     = newBlocklists()
+	blocklistsLock sync.RWMutex
+)
+
+// Returns the builtin lists
+func newBlocklists() *Blocklists {
+	lists := &Blocklists{
+		Bad:        make(map[string]bool),
+		Porn:       make(map[string]bool),
+		Shorteners: make(map[string]bool),
+		Lookalikes: make(map[string]string),
+	}
+
+	for k := range BuiltinBadSites {
+		lists.Bad[k] = true
+	}
+	for k := range BuiltinPornSites {
+		lists.Porn[k] = true
+	}
+	for k := range BuiltinShorteners {
+		lists.Shorteners[k] = true
+	}
+	for k := range BuiltinLookalikeTargets {
+		lists.Lookalikes[domainSkeleton(k)] = k
+	}
+
+	return lists
+}
+
+func GetBlocklists() *Blocklists {
+	blocklistsLock.RLock()
+	defer blocklistsLock.RUnlock()
+	return blocklists
+}
+
+// LoadBlocklists (re)loads the blocklist files, the builtin lists are used if the directory doesn't exist
+func LoadBlocklists() (*Blocklists, error) {
+	dir := os.Getenv("YAGPDB_AUTOMOD_BLOCKLISTS")
+	if dir == "" {
+		dir = "blocklists"
+	}
+
+	lists := newBlocklists()
+
+	lookalikes := make(map[string]bool)
+	for folder, dst := range map[string]map[string]bool{"bad": lists.Bad, "porn": lists.Porn, "shorteners": lists.Shorteners, "lookalike": lookalikes} {
+		files, err := filepath.Glob(filepath.Join(dir, folder, "*.txt"))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, file := range files {
+			err = readDomainList(file, dst)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for k := range lookalikes {
+		lists.Lookalikes[domainSkeleton(k)] = k
+	}
+
+	blocklistsLock.Lock()
+	blocklists = lists
+	blocklistsLock.Unlock()
+
+	logrus.WithField("bad", len(lists.Bad)).WithField("porn", len(lists.Porn)).WithField("shorteners", len(lists.Shorteners)).WithField("lookalike", len(lists.Lookalikes)).Info("Loaded automod blocklists")
+	return lists, nil
+}
+
+// Adds the domains in the file to dst
+func readDomainList(path string, dst map[string]bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexAny(line, "#!"); i != -1 {
+			line = line[:i]
+		}
+
+		// Hosts files have the address first
+		fields := strings.Fields(line)
+		if len(fields) < 1 {
+			continue
+		}
+		entry := strings.TrimSuffix(strings.TrimPrefix(fields[len(fields)-1], "||"), "^")
+
+		host := linkHost(entry)
+		if strings.Contains(host, ".") && net.ParseIP(host) == nil {
+			dst[host] = true
+		}
+	}
+
+	return scanner.Err()
+}
+
+// Characters from other scripts (and accented ones) that look like latin letters
+var confusables = map[rune]rune{
+	'а': 'a', 'à': 'a', 'á': 'a', 'â': 'a', 'ã': 'a', 'ä': 'a', 'å': 'a', 'α': 'a',
+	'ь': 'b', 'в': 'b',
+	'с': 'c', 'ç': 'c', 'ϲ': 'c',
+	'ԁ': 'd',
+	'е': 'e', 'è': 'e', 'é': 'e', 'ê': 'e', 'ë': 'e', 'ε': 'e',
+	'ɡ': 'g',
+	'һ': 'h',
+	'і': 'i', 'ì': 'i', 'í': 'i', 'î': 'i', 'ï': 'i', 'ı': 'i', 'ι': 'i',
+	'ј': 'j',
+	'к': 'k', 'κ': 'k',
+	'ӏ': 'l',
+	'м': 'm',
+	'ո': 'n', 'ñ': 'n', 'п': 'n',
+	'о': 'o', 'ò': 'o', 'ó': 'o', 'ô': 'o', 'õ': 'o', 'ö': 'o', 'ο': 'o', 'σ': 'o',
+	'р': 'p', 'ρ': 'p',
+	'ԛ': 'q',
+	'г': 'r',
+	'ѕ': 's',
+	'т': 't', 'τ': 't',
+	'ս': 'u', 'ù': 'u', 'ú': 'u', 'û': 'u', 'ü': 'u', 'υ': 'u',
+	'ν': 'v', 'ѵ': 'v',
+	'ѡ': 'w', 'ω': 'w',
+	'х': 'x', 'χ': 'x',
+	'у': 'y', 'ý': 'y', 'ÿ': 'y',
+	'ᴢ': 'z',
+}
+
+// Letters and digits that are easily mistaken for each other, replaced with the same one
+var skeletonReplacer = strings.NewReplacer("rn", "m", "vv", "w", "cl", "d", "0", "o", "1", "l", "i", "l", "3", "e", "5", "s", "-", "")
+
+// domainSkeleton returns what the domain looks like, "dlscord.com", "disc0rd.com" and "dіscord.com" (cyrillic і)
+// all have the same skeleton as "discord.com"
+func domainSkeleton(host string) string {
+	if decoded, err := idna.ToUnicode(host); err == nil {
+		host = decoded
+	}
+
+	var buf bytes.Buffer
+	for _, r := range strings.ToLower(host) {
+		if c, ok := confusables[r]; ok {
+			r = c
+		}
+		if r > unicode.MaxASCII {
+			// Combining marks and such
+			if unicode.Is(unicode.Mn, r) {
+				continue
+			}
+		}
+		buf.WriteRune(r)
+	}
+
+	return skeletonReplacer.Replace(buf.String())
+}
+
+// LookalikeOf returns the commonly impersonated domain the host looks like, an empty string if it's the real
+// domain, a subdomain of it or doesn't look like any of them
+func (b *Blocklists) LookalikeOf(host string) string {
+	for host != "" {
+		if target, ok := b.Lookalikes[domainSkeleton(host)]; ok {
+			if target == host {
+				return ""
+			}
+			return target
+		}
+
+		i := strings.IndexByte(host, '.')
+		if i == -1 {
+			break
+		}
+		host = host[i+1:]
+	}
+
+	return ""
+}
+
+// Doesn't follow redirects, they're followed manually to stop when the link leaves the shorteners
+var shortenerClient = &http.Client{
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// ResolveShortLinks follows the links in the message that are on url shorteners and caches where they lead, for the sites rule
+// This makes http requests, so it has to be done before the state is locked for the rule checks
+func (b *Blocklists) ResolveShortLinks(client *redis.Client, m *discordgo.Message) {
+	ctx, cancel := context.WithTimeout(context.Background(), shortLinkTimeout)
+	defer cancel()
+
+	n := 0
+	for _, link := range messageLinks(m, true) {
+		if !matchesDomain(linkHost(link), b.Shorteners) {
+			continue
+		}
+
+		if n >= maxShortLinksPerMessage {
+			break
+		}
+		n++
+
+		_, err := b.ResolveShortLink(ctx, client, link)
+		if err != nil {
+			logrus.WithError(err).WithField("link", link).Debug("Failed following short link")
+		}
+	}
+}
+
+func shortLinkKey(link string) string {
+	if !strings.Contains(link, "://") {
+		link = "http://" + link
+	}
+	return KeyShortLink(link)
+}
+
+// CachedShortLink returns where the short link leads to, an empty string if it hasn't been resolved
+func CachedShortLink(client *redis.Client, link string) (string, error) {
+	reply := client.Cmd("GET", shortLinkKey(link))
+	if reply.Type == redis.NilReply {
+		return "", nil
+	}
+	return reply.Str()
+}
+
+// ResolveShortLink follows the link through the url shorteners until ctx is done, returning the first link that isn't on one
+// Results are cached in redis, on failure the link resolved so far is returned along with the error
+func (b *Blocklists) ResolveShortLink(ctx context.Context, client *redis.Client, link string) (string, error) {
+	cached, err := CachedShortLink(client, link)
+	if err != nil || cached != "" {
+		return cached, err
+	}
+
+	if !strings.Contains(link, "://") {
+		link = "http://" + link
+	}
+
+	current := link
+	for i := 0; i < maxShortenerHops && matchesDomain(linkHost(current), b.Shorteners); i++ {
+		req, err := http.NewRequest("GET", current, nil)
+		if err != nil {
+			return current, err
+		}
+
+		resp, err := shortenerClient.Do(req.WithContext(ctx))
+		if err != nil {
+			return current, err
+		}
+		resp.Body.Close()
+
+		location, err := resp.Location()
+		if err != nil {
+			// Not a redirect
+			break
+		}
+		current = location.String()
+	}
+
+	err = client.Cmd("SET", shortLinkKey(link), current, "EX", shortLinkCacheValid).Err
+	return current, err
+}
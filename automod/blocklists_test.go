@@ -0,0 +1,103 @@
+package automod
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestDomainSkeleton(t *testing.T) {
+	cases := []struct {
+		host      string
+		lookalike bool
+	}{
+		{"discord.com", true},
+		{"DISCORD.com", true},
+		{"dlscord.com", true},
+		{"disc0rd.com", true},
+		{"dis-cord.com", true},
+		// Cyrillic і
+		{"d\u0456scord.com", true},
+		{"xn--dscord-pvf.com", true},
+		// Combining accent
+		{"di\u0301scord.com", true},
+		{"discord.gg", false},
+		{"discordapp.com", false},
+		{"dscord.com", false},
+	}
+
+	skeleton := domainSkeleton("discord.com")
+	for _, c := range cases {
+		if got := domainSkeleton(c.host) == skeleton; got != c.lookalike {
+			t.Errorf("domainSkeleton(%q) = %q, expected lookalike of discord.com: %t", c.host, domainSkeleton(c.host), c.lookalike)
+		}
+	}
+}
+
+func TestLookalikeOf(t *testing.T) {
+	lists := &Blocklists{Lookalikes: make(map[string]string)}
+	for _, target := range []string{"discord.com", "steamcommunity.com"} {
+		lists.Lookalikes[domainSkeleton(target)] = target
+	}
+
+	cases := []struct {
+		host     string
+		expected string
+	}{
+		{"discord.com", ""},
+		{"cdn.discord.com", ""},
+		{"example.com", ""},
+		{"dlscord.com", "discord.com"},
+		{"login.dlscord.com", "discord.com"},
+		{"steamcornmunity.com", "steamcommunity.com"},
+		{"steamcommunlty.com", "steamcommunity.com"},
+	}
+
+	for _, c := range cases {
+		if got := lists.LookalikeOf(c.host); got != c.expected {
+			t.Errorf("LookalikeOf(%q) = %q, expected %q", c.host, got, c.expected)
+		}
+	}
+}
+
+func TestReadDomainList(t *testing.T) {
+	f, err := ioutil.TempFile("", "blocklist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.WriteString(`# A comment
+example.com
+WWW.Example.org # trailing comment
+0.0.0.0 hosts.example.net
+127.0.0.1 localhost
+||adblock.example.com^
+! adblock comment
+https://link.example.com/path
+10.0.0.1
+
+`)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	domains := make(map[string]bool)
+	err = readDomainList(f.Name(), domains)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]bool{
+		"example.com":         true,
+		"example.org":         true,
+		"hosts.example.net":   true,
+		"adblock.example.com": true,
+		"link.example.com":    true,
+	}
+	if !reflect.DeepEqual(domains, expected) {
+		t.Errorf("Got %v, expected %v", domains, expected)
+	}
+}
@@ -6,23 +6,35 @@ import (
 	"github.com/fzzy/radix/redis"
 	"github.com/jonas747/discordgo"
 	"github.com/jonas747/yagpdb/bot"
+	"github.com/jonas747/yagpdb/commands"
 	"github.com/jonas747/yagpdb/common"
 	"github.com/jonas747/yagpdb/common/pubsub"
 	"github.com/jonas747/yagpdb/moderation"
+	"strings"
 )
 
 func (p *Plugin) InitBot() {
+	commands.CommandSystem.RegisterCommands(cmds...)
 	common.BotSession.AddHandler(bot.CustomMessageCreate(HandleMessageCreate))
 	common.BotSession.AddHandler(bot.CustomMessageUpdate(HandleMessageUpdate))
+	common.BotSession.AddHandler(bot.CustomGuildMemberAdd(HandleGuildMemberAdd))
 }
 
 func (p *Plugin) StartBot() {
 	pubsub.AddHandler("update_automod_rules", HandleUpdateAutomodRules, nil)
+	go runViolationCleaner()
+
+	_, err := LoadBlocklists()
+	if err != nil {
+		logrus.WithError(err).Error("Failed loading automod blocklists, using the builtin lists")
+	}
 }
 
 // Invalidate the cache when the rules have changed
 func HandleUpdateAutomodRules(event *pubsub.Event) {
 	bot.Cache.Delete(KeyAllRules(event.TargetGuild))
+	bot.Cache.Delete(KeyCustomRulesCache(event.TargetGuild))
+	bot.Cache.Delete(KeyChannelOverridesCache(event.TargetGuild))
 }
 
 func CachedGetConfig(client *redis.Client, gID string) (*Config, error) {
@@ -31,13 +43,20 @@ func CachedGetConfig(client *redis.Client, gID string) (*Config, error) {
 	}
 	conf, err := GetConfig(client, gID)
 	if err == nil {
-		// Compile the sites and word list
-		conf.Sites.GetCompiled()
-		conf.Words.GetCompiled()
+		conf.compileRules()
 	}
 	return conf, err
 }
 
+// Compiles the sites, link and invite allowlists, attachment types and word list
+func (c *Config) compileRules() {
+	c.Sites.GetCompiled()
+	c.Links.GetCompiled()
+	c.Invite.GetCompiled()
+	c.Attachments.GetCompiled()
+	c.Words.GetCompiled()
+}
+
 func HandleMessageCreate(s *discordgo.Session, evt *discordgo.MessageCreate, client *redis.Client) {
 	CheckMessage(s, evt.Message, client)
 }
@@ -82,12 +101,37 @@ func CheckMessage(s *discordgo.Session, m *discordgo.Message, client *redis.Clie
 		return
 	}
 
-	del := false // Set if a rule triggered a message delete
+	violated := false // Set if any rule was triggered
+	del := false      // Set if a rule that deletes the message was triggered
 	punishMsg := ""
 	highestPunish := PunishNone
-	muteDuration := 0
+	var highestRule *BaseRule
+	var triggered []*triggeredRule
+
+	override, err := CachedGetChannelOverride(client, guild.ID, channel.ID)
+	if err != nil {
+		logrus.WithError(err).Error("Failed retrieving channel overrides")
+	}
+
+	rules := config.RulesInChannel(override)
 
-	rules := []Rule{config.Spam, config.Invite, config.Mention, config.Links, config.Words, config.Sites}
+	customRules, err := CachedGetCustomRules(client, guild.ID)
+	if err != nil {
+		logrus.WithError(err).Error("Failed retrieving custom rules")
+	}
+	for _, r := range customRules {
+		rules = append(rules, r)
+	}
+
+	// Extra channels to log in, set by the custom rules
+	var extraLogChannels []string
+
+	// Follow short links now, as that makes http requests which shouldn't be done while the state is locked
+	for _, r := range rules {
+		if sites, ok := r.(*SitesRule); ok && sites.Enabled {
+			GetBlocklists().ResolveShortLinks(client, m)
+		}
+	}
 
 	// We gonna need to have this locked while we check
 	s.State.RLock()
@@ -96,30 +140,45 @@ func CheckMessage(s *discordgo.Session, m *discordgo.Message, client *redis.Clie
 			continue
 		}
 
-		d, punishment, msg, err := r.Check(m, channel, client)
-		if d {
+		var d bool
+		var punishment Punishment
+		var msg string
+		var err error
+		if memberRule, ok := r.(MemberRule); ok {
+			d, punishment, msg, err = memberRule.CheckMember(m, member, channel, client)
+		} else {
+			d, punishment, msg, err = r.Check(m, channel, client)
+		}
+		// If the rule did not trigger there wasnt any violation
+		if !d {
+			continue
+		}
+
+		violated = true
+		if !r.GetBase().KeepMessage {
 			del = true
 		}
+
 		if err != nil {
 			logrus.WithError(err).Error("Failed checking aumod rule:", err)
 			continue
 		}
 
-		// If the rule did not trigger a deletion there wasnt any violation
-		if !d {
-			continue
+		if custom, ok := r.(*CustomRule); ok && custom.LogChannel != "" && custom.LogChannel != config.LogChannel {
+			extraLogChannels = append(extraLogChannels, custom.LogChannel)
 		}
 
 		punishMsg += msg + "\n"
+		triggered = append(triggered, &triggeredRule{Name: r.Name(), Rule: r.GetBase(), Msg: msg})
 
-		if punishment > highestPunish {
+		if punishment > highestPunish || highestRule == nil {
 			highestPunish = punishment
-			muteDuration = r.GetMuteDuration()
+			highestRule = r.GetBase()
 		}
 	}
 	s.State.RUnlock()
 
-	if !del {
+	if !violated {
 		return
 	}
 
@@ -128,22 +187,142 @@ func CheckMessage(s *discordgo.Session, m *discordgo.Message, client *redis.Clie
 		punishMsg = punishMsg[:len(punishMsg)-1]
 	}
 
-	switch highestPunish {
-	case PunishNone:
-		err = bot.SendDM(s, member.User.ID, fmt.Sprintf("**Automoderator for %s, Rule violations:**\n%s\nRepeating this offence may cause you a kick, mute or ban.", guild.Name, punishMsg))
-	case PunishMute:
-		err = moderation.MuteUnmuteUser(nil, client, true, channel.GuildID, channel.ID, common.BotSession.State.User.User, "Automoderator: "+punishMsg, member, muteDuration)
-	case PunishKick:
-		err = moderation.KickUser(nil, channel.GuildID, channel.ID, common.BotSession.State.User.User, "Automoderator: "+punishMsg, member.User)
-	case PunishBan:
-		err = moderation.BanUser(nil, channel.GuildID, channel.ID, common.BotSession.State.User.User, "Automoderator: "+punishMsg, member.User)
+	modConfig, err := moderation.GetConfig(guild.ID)
+	if err != nil {
+		logrus.WithError(err).Error("Failed retrieving moderation config")
 	}
 
-	// Execute the punishment before removing the message to make sure it's included in logs
-	s.ChannelMessageDelete(m.ChannelID, m.ID)
+	action := ""
+	if modConfig != nil && modConfig.WarnAutomodViolations {
+		// The moderation warning thresholds decide the punishment instead of the rules
+		action = "Warned"
+		err = moderation.WarnUser(modConfig, client, channel.GuildID, channel.ID, common.BotSession.State.User.User, member.User, "Automoderator: "+punishMsg)
+	} else if highestRule != nil {
+		switch highestPunish {
+		case PunishNone:
+			if warning := warningDM(guild, channel, member, m, triggered); warning != "" {
+				action = "Warned"
+				err = bot.SendDM(s, member.User.ID, warning)
+			}
+		case PunishMute:
+			action = fmt.Sprintf("Muted (%d min)", highestRule.MuteDuration)
+			err = moderation.MuteUnmuteUser(nil, client, true, channel.GuildID, channel.ID, common.BotSession.State.User.User, "Automoderator: "+punishMsg, member, highestRule.MuteDuration)
+		case PunishKick:
+			action = "Kicked"
+			err = moderation.KickUser(nil, channel.GuildID, channel.ID, common.BotSession.State.User.User, "Automoderator: "+punishMsg, member.User)
+		case PunishBan:
+			action = "Banned"
+			if highestRule.BanDuration > 0 {
+				action = fmt.Sprintf("Banned (%d min)", highestRule.BanDuration)
+			}
+			err = moderation.BanUserWithDuration(nil, client, channel.GuildID, channel.ID, common.BotSession.State.User.User, "Automoderator: "+punishMsg, member.User, highestRule.BanDuration)
+		}
+	}
 
 	if err != nil {
 		logrus.WithError(err).Error("Error carrying out punishment")
 	}
 
+	if del {
+		if action != "" {
+			action += ", "
+		}
+		action += "Deleted message"
+	}
+
+	if config.LogChannel != "" {
+		sendLogMessage(config.LogChannel, channel, member.User, m.Content, punishMsg, action)
+	}
+	for _, logChannel := range extraLogChannels {
+		sendLogMessage(logChannel, channel, member.User, m.Content, punishMsg, action)
+	}
+
+	// Execute the punishment before removing the message to make sure it's included in logs
+	if del {
+		s.ChannelMessageDelete(m.ChannelID, m.ID)
+	}
+
+	err = StoreViolations(guild.ID, channel, member.User, m, triggered, action)
+	if err != nil {
+		logrus.WithError(err).Error("Failed storing automod violations")
+	}
+}
+
+// A rule that was triggered by a message, and the reason it was
+type triggeredRule struct {
+	Name string
+	Rule *BaseRule
+	Msg  string
+}
+
+// Returns the warning to DM the user for the triggered rules, empty if all of them has warnings disabled
+func warningDM(guild *discordgo.Guild, channel *discordgo.Channel, member *discordgo.Member, m *discordgo.Message, triggered []*triggeredRule) string {
+	defaultWarnings := ""
+	customWarnings := ""
+
+	for _, t := range triggered {
+		if t.Rule.DisableWarning {
+			continue
+		}
+
+		if t.Rule.WarningMessage == "" {
+			defaultWarnings += t.Msg + "\n"
+			continue
+		}
+
+		out, err := common.ParseExecuteTemplate(channel.GuildID, t.Rule.WarningMessage, map[string]interface{}{
+			"User":    member.User,
+			"Server":  guild,
+			"Channel": channel,
+			"Reason":  t.Msg,
+			"Content": m.Content,
+		})
+		if err != nil {
+			logrus.WithError(err).WithField("guild", guild.ID).Error("Failed executing automod warning template")
+			defaultWarnings += t.Msg + "\n"
+			continue
+		}
+
+		customWarnings += out + "\n"
+	}
+
+	out := ""
+	if defaultWarnings != "" {
+		out = fmt.Sprintf("**Automoderator for %s, Rule violations:**\n%sRepeating this offence may cause you a kick, mute or ban.\n", guild.Name, defaultWarnings)
+	}
+	out += customWarnings
+
+	return strings.TrimSpace(out)
+}
+
+// Sends the details of a automod trigger to the log channel
+func sendLogMessage(logChannel string, channel *discordgo.Channel, user *discordgo.User, content, reasons, action string) {
+	if action == "" {
+		action = "None"
+	}
+
+	if reasons == "" {
+		reasons = "Unknown"
+	}
+
+	if content == "" {
+		content = "*No text content*"
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       "Automoderator triggered",
+		Description: common.CutStringShort(content, 1500),
+		Color:       0xe74c3c,
+		Fields: []*discordgo.MessageEmbedField{
+			&discordgo.MessageEmbedField{Name: "User", Value: fmt.Sprintf("%s#%s (%s)", user.Username, user.Discriminator, user.ID), Inline: true},
+			&discordgo.MessageEmbedField{Name: "Channel", Value: "<#" + channel.ID + ">", Inline: true},
+			&discordgo.MessageEmbedField{Name: "Rule violations", Value: reasons},
+			&discordgo.MessageEmbedField{Name: "Action", Value: action},
+		},
+	}
+
+	_, err := common.SendEmbedWithFallback(common.BotSession, logChannel, embed)
+	if err != nil {
+		logrus.WithError(err).WithField("channel", logChannel).Error("Failed sending automod log message")
+	}
 }
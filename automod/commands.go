@@ -0,0 +1,90 @@
+package automod
+
+import (
+	"fmt"
+	"github.com/fzzy/radix/redis"
+	"github.com/jonas747/discordgo"
+	"github.com/jonas747/dutil/commandsystem"
+	"github.com/jonas747/yagpdb/commands"
+	"github.com/jonas747/yagpdb/common"
+	"time"
+)
+
+var cmds = []commandsystem.CommandHandler{
+	&commands.CustomCommand{
+		CustomEnabled: true,
+		Cooldown:      5,
+		Category:      commands.CategoryModeration,
+		SimpleCommand: &commandsystem.SimpleCommand{
+			Name:         "Violations",
+			Description:  "Lists the recent automoderator violations of a member",
+			RequiredArgs: 1,
+			Arguments: []*commandsystem.ArgumentDef{
+				&commandsystem.ArgumentDef{Name: "User", Type: commandsystem.ArgumentTypeUser},
+				&commandsystem.ArgumentDef{Name: "Num", Description: "Number of violations to show, max 25", Type: commandsystem.ArgumentTypeNumber},
+			},
+		},
+		RunFunc: func(parsed *commandsystem.ParsedCommand, client *redis.Client, m *discordgo.MessageCreate) (interface{}, error) {
+			perm, err := common.AdminOrPerm(discordgo.PermissionManageMessages, m.Author.ID, m.ChannelID)
+			if err != nil {
+				return "Failed checking permissions", err
+			}
+			if !perm {
+				return "You do not have manage messages permissions in this channel.", nil
+			}
+
+			target := parsed.Args[0].DiscordUser()
+
+			num := 10
+			if parsed.Args[1] != nil {
+				num = parsed.Args[1].Int()
+			}
+			if num > 25 {
+				num = 25
+			} else if num < 1 {
+				num = 1
+			}
+
+			violations, err := GetViolations(common.MustParseInt(parsed.Guild.ID), common.MustParseInt(target.ID), num, 0)
+			if err != nil {
+				return "Failed retrieving violations", err
+			}
+
+			if len(violations) < 1 {
+				return fmt.Sprintf("**%s#%s** has no recent automoderator violations", target.Username, target.Discriminator), nil
+			}
+
+			out := fmt.Sprintf("Last %d automoderator violation(s) of **%s#%s**:\n", len(violations), target.Username, target.Discriminator)
+			for _, v := range violations {
+				falsePositive := ""
+				if v.FalsePositive {
+					falsePositive = " *(false positive)*"
+				}
+				out += fmt.Sprintf("**%s** (%s): %s - %s%s\n", v.RuleName(), v.CreatedAt.UTC().Format(time.RFC822), v.Reason, v.Action, falsePositive)
+			}
+			return out, nil
+		},
+	},
+	&commands.CustomCommand{
+		Cooldown:             5,
+		Category:             commands.CategoryModeration,
+		HideFromCommandsPage: true,
+		SimpleCommand: &commandsystem.SimpleCommand{
+			Name:         "ReloadBlocklists",
+			Description:  "Reloads the automoderator domain blocklist files",
+			HideFromHelp: true,
+		},
+		RunFunc: func(parsed *commandsystem.ParsedCommand, client *redis.Client, m *discordgo.MessageCreate) (interface{}, error) {
+			if m.Author.ID != common.Conf.Owner {
+				return "Only bot owner can run this", nil
+			}
+
+			lists, err := LoadBlocklists()
+			if err != nil {
+				return "Failed loading blocklists", err
+			}
+
+			return fmt.Sprintf("Loaded %d bad, %d porn, %d url shortener and %d lookalike domains", len(lists.Bad), len(lists.Porn), len(lists.Shorteners), len(lists.Lookalikes)), nil
+		},
+	},
+}
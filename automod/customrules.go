@@ -0,0 +1,238 @@
+package automod
+
+// Custom rules, admin defined rules made of conditions and actions
+
+import (
+	"encoding/json"
+	"github.com/Sirupsen/logrus"
+	"github.com/fzzy/radix/redis"
+	"github.com/jonas747/discordgo"
+	"github.com/jonas747/yagpdb/bot"
+	"github.com/jonas747/yagpdb/common"
+	"github.com/patrickmn/go-cache"
+	"regexp"
+	"sort"
+	"time"
+)
+
+const MaxCustomRules = 25
+
+type CustomRule struct {
+	ID      int    `json:"id"`
+	Title   string `json:"title" schema:"title" valid:",1,100"`
+	Enabled bool   `json:"enabled" schema:"enabled"`
+
+	// Trigger if any of the conditions are met instead of all of them
+	MatchAny bool `json:"match_any" schema:"match_any"`
+
+	// Conditions, unset ones are not checked
+	ContentRegex      string   `json:"content_regex" schema:"content_regex" valid:"regex,1000"`
+	HasAttachment     bool     `json:"has_attachment" schema:"has_attachment"`
+	MinMentions       int      `json:"min_mentions" schema:"min_mentions" valid:"0,100"`
+	MaxAccountAgeDays int      `json:"max_account_age_days" schema:"max_account_age_days" valid:"0,3650"`
+	MaxMemberAgeHours int      `json:"max_member_age_hours" schema:"max_member_age_hours" valid:"0,8760"`
+	HasRole           string   `json:"has_role" schema:"has_role" valid:"role,true"`
+	LacksRole         string   `json:"lacks_role" schema:"lacks_role" valid:"role,true"`
+	Channels          []string `json:"channels" schema:"channels" valid:"channel,true"`
+
+	// Actions, the highest of ban, kick and mute is used
+	Delete         bool   `json:"delete" schema:"delete"`
+	WarnDM         bool   `json:"warn_dm" schema:"warn_dm"`
+	WarningMessage string `json:"warning_message" schema:"warning_message" valid:"template,1000"`
+	Mute           bool   `json:"mute" schema:"mute"`
+	MuteDuration   int    `json:"mute_duration" schema:"mute_duration" valid:"0,525600"`
+	Kick           bool   `json:"kick" schema:"kick"`
+	Ban            bool   `json:"ban" schema:"ban"`
+	BanDuration    int    `json:"ban_duration" schema:"ban_duration" valid:"0,525600"`
+	// Log triggers in this channel, in addition to the automod log channel
+	LogChannel string `json:"log_channel" schema:"log_channel" valid:"channel,true"`
+
+	compiledRegex *regexp.Regexp
+	base          *BaseRule
+}
+
+func (r *CustomRule) Name() string { return "Custom" }
+
+// Compiles the content regex, done when loading the rules so that they can be shared between goroutines after
+func (r *CustomRule) compile() {
+	r.compiledRegex = nil
+	if r.ContentRegex != "" {
+		compiled, err := regexp.Compile("(?i)" + r.ContentRegex)
+		if err == nil {
+			r.compiledRegex = compiled
+		}
+	}
+
+	r.base = &BaseRule{
+		Enabled:        r.Enabled,
+		MuteDuration:   r.MuteDuration,
+		BanDuration:    r.BanDuration,
+		KeepMessage:    !r.Delete,
+		DisableWarning: !r.WarnDM,
+		WarningMessage: r.WarningMessage,
+	}
+}
+
+// GetBase returns the actions of the rule as a BaseRule, for the shared punishment handling
+func (r *CustomRule) GetBase() *BaseRule {
+	if r.base == nil {
+		r.compile()
+	}
+	return r.base
+}
+
+func (r *CustomRule) ShouldIgnore(evt *discordgo.Message, m *discordgo.Member) bool {
+	return !r.Enabled
+}
+
+// Check without the member, conditions on the member are never met
+func (r *CustomRule) Check(evt *discordgo.Message, channel *discordgo.Channel, client *redis.Client) (del bool, punishment Punishment, msg string, err error) {
+	return r.CheckMember(evt, nil, channel, client)
+}
+
+func (r *CustomRule) CheckMember(evt *discordgo.Message, member *discordgo.Member, channel *discordgo.Channel, client *redis.Client) (del bool, punishment Punishment, msg string, err error) {
+	if !r.matches(evt, member, channel) {
+		return
+	}
+
+	del = true
+	msg = "Triggered the rule " + r.Title
+
+	if r.Ban {
+		punishment = PunishBan
+	} else if r.Kick {
+		punishment = PunishKick
+	} else if r.Mute {
+		punishment = PunishMute
+	}
+
+	return
+}
+
+// Returns true if all (or any with MatchAny) of the set conditions are met, rules without any conditions never match
+func (r *CustomRule) matches(evt *discordgo.Message, member *discordgo.Member, channel *discordgo.Channel) bool {
+	conditions := make([]bool, 0)
+
+	if r.ContentRegex != "" {
+		conditions = append(conditions, r.compiledRegex != nil && r.compiledRegex.MatchString(evt.Content))
+	}
+
+	if r.HasAttachment {
+		conditions = append(conditions, len(evt.Attachments) > 0)
+	}
+
+	if r.MinMentions > 0 {
+		conditions = append(conditions, len(evt.Mentions)+len(evt.MentionRoles) >= r.MinMentions)
+	}
+
+	if r.MaxAccountAgeDays > 0 {
+		age := time.Since(common.SnowflakeTime(evt.Author.ID))
+		conditions = append(conditions, age < time.Duration(r.MaxAccountAgeDays)*time.Hour*24)
+	}
+
+	if r.MaxMemberAgeHours > 0 {
+		young := false
+		if member != nil {
+			joinedAt, err := discordgo.Timestamp(member.JoinedAt).Parse()
+			young = err == nil && time.Since(joinedAt) < time.Duration(r.MaxMemberAgeHours)*time.Hour
+		}
+		conditions = append(conditions, young)
+	}
+
+	if r.HasRole != "" {
+		conditions = append(conditions, member != nil && containsString(member.Roles, r.HasRole))
+	}
+
+	if r.LacksRole != "" {
+		conditions = append(conditions, member != nil && !containsString(member.Roles, r.LacksRole))
+	}
+
+	if len(r.Channels) > 0 {
+		conditions = append(conditions, containsString(r.Channels, channel.ID))
+	}
+
+	if len(conditions) < 1 {
+		return false
+	}
+
+	for _, met := range conditions {
+		if met && r.MatchAny {
+			return true
+		}
+		if !met && !r.MatchAny {
+			return false
+		}
+	}
+
+	return !r.MatchAny
+}
+
+func containsString(slice []string, s string) bool {
+	for _, v := range slice {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *CustomRule) Save(client *redis.Client, guildID string) error {
+	serialized, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	return client.Cmd("HSET", KeyCustomRules(guildID), r.ID, serialized).Err
+}
+
+type customRulesByID []*CustomRule
+
+func (c customRulesByID) Len() int           { return len(c) }
+func (c customRulesByID) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+func (c customRulesByID) Less(i, j int) bool { return c[i].ID < c[j].ID }
+
+// GetCustomRules returns the custom rules of the guild sorted by id, and the highest id
+func GetCustomRules(client *redis.Client, guildID string) ([]*CustomRule, int, error) {
+	hash, err := client.Cmd("HGETALL", KeyCustomRules(guildID)).Hash()
+	if err != nil {
+		if _, ok := err.(*redis.CmdError); ok {
+			return []*CustomRule{}, 0, nil
+		}
+		return nil, 0, err
+	}
+
+	highest := 0
+	result := make([]*CustomRule, 0, len(hash))
+	for k, raw := range hash {
+		var decoded *CustomRule
+		err = json.Unmarshal([]byte(raw), &decoded)
+		if err != nil {
+			logrus.WithError(err).WithField("guild", guildID).WithField("custom_rule", k).Error("Failed decoding custom automod rule")
+			continue
+		}
+
+		decoded.compile()
+		result = append(result, decoded)
+		if decoded.ID > highest {
+			highest = decoded.ID
+		}
+	}
+
+	sort.Sort(customRulesByID(result))
+	return result, highest, nil
+}
+
+// CachedGetCustomRules returns the custom rules from the local bot cache, which is cleared when the rules are updated
+func CachedGetCustomRules(client *redis.Client, guildID string) ([]*CustomRule, error) {
+	if rules, ok := bot.Cache.Get(KeyCustomRulesCache(guildID)); ok {
+		return rules.([]*CustomRule), nil
+	}
+
+	rules, _, err := GetCustomRules(client, guildID)
+	if err != nil {
+		return nil, err
+	}
+
+	bot.Cache.Set(KeyCustomRulesCache(guildID), rules, cache.DefaultExpiration)
+	return rules, nil
+}
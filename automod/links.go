@@ -0,0 +1,102 @@
+package automod
+
+// Link extraction and domain matching used by the links and sites rules
+
+import (
+	"github.com/jonas747/discordgo"
+	"golang.org/x/net/idna"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Matches links anywhere in a message, with a scheme or starting with www.
+var linkRegex = regexp.MustCompile(`(?i)(?:(?:https?|steam):\/\/|\bwww\.)[^\s<>]+[^<>.,:;"')\]\s]`)
+
+// Returns all the links in the message content and embeds, and in the attachments if includeAttachments is set
+func messageLinks(m *discordgo.Message, includeAttachments bool) []string {
+	links := linkRegex.FindAllString(m.Content, -1)
+
+	for _, embed := range m.Embeds {
+		if embed.URL != "" {
+			links = append(links, embed.URL)
+		}
+
+		text := embed.Title + " " + embed.Description
+		for _, field := range embed.Fields {
+			text += " " + field.Value
+		}
+		links = append(links, linkRegex.FindAllString(text, -1)...)
+	}
+
+	if includeAttachments {
+		for _, attachment := range m.Attachments {
+			links = append(links, attachment.URL)
+		}
+	}
+
+	return links
+}
+
+// Replaces the different unicode full stops that browsers also treat as dots
+var hostDotReplacer = strings.NewReplacer("。", ".", "．", ".", "｡", ".")
+
+// normalizeHost lower cases the host, converts unicode domains to punycode and strips the port, trailing dot and "www."
+func normalizeHost(host string) string {
+	host = strings.ToLower(strings.TrimSpace(hostDotReplacer.Replace(host)))
+
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	host = strings.TrimSuffix(host, ".")
+	if ascii, err := idna.ToASCII(host); err == nil {
+		host = ascii
+	}
+
+	return strings.TrimPrefix(host, "www.")
+}
+
+// Returns the normalized host of the link, or an empty string if it couldn't be parsed
+func linkHost(link string) string {
+	if !strings.Contains(link, "://") {
+		link = "http://" + link
+	}
+
+	parsed, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+
+	return normalizeHost(parsed.Host)
+}
+
+// Compiles a whitespace separated list of domains, entries may be written as links ("https://google.com/")
+func compileDomains(list string) map[string]bool {
+	domains := make(map[string]bool)
+	for _, field := range strings.Fields(list) {
+		host := linkHost(field)
+		if host != "" {
+			domains[host] = true
+		}
+	}
+	return domains
+}
+
+// Returns true if the host or any of its parent domains is in domains, "a.b.example.com" matches "example.com"
+func matchesDomain(host string, domains map[string]bool) bool {
+	for host != "" {
+		if domains[host] {
+			return true
+		}
+
+		i := strings.IndexByte(host, '.')
+		if i == -1 {
+			break
+		}
+		host = host[i+1:]
+	}
+
+	return false
+}
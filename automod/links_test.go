@@ -0,0 +1,82 @@
+package automod
+
+import (
+	"github.com/jonas747/discordgo"
+	"reflect"
+	"testing"
+)
+
+func TestMessageLinks(t *testing.T) {
+	m := &discordgo.Message{
+		Content: "check out https://example.com/page, www.google.com and (http://a.b.c/x) <https://embedless.com> example.org",
+		Embeds: []*discordgo.MessageEmbed{
+			&discordgo.MessageEmbed{
+				URL:         "https://embed.com",
+				Description: "more at steam://run/123.",
+			},
+		},
+		Attachments: []*discordgo.MessageAttachment{
+			&discordgo.MessageAttachment{URL: "https://cdn.discordapp.com/file.png"},
+		},
+	}
+
+	expected := []string{"https://example.com/page", "www.google.com", "http://a.b.c/x", "https://embedless.com", "https://embed.com", "steam://run/123"}
+	if got := messageLinks(m, false); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Got %v, expected %v", got, expected)
+	}
+
+	expected = append(expected, "https://cdn.discordapp.com/file.png")
+	if got := messageLinks(m, true); !reflect.DeepEqual(got, expected) {
+		t.Errorf("With attachments got %v, expected %v", got, expected)
+	}
+}
+
+func TestLinkHost(t *testing.T) {
+	cases := []struct {
+		link     string
+		expected string
+	}{
+		{"https://example.com/page", "example.com"},
+		{"HTTP://Example.COM", "example.com"},
+		{"www.google.com", "google.com"},
+		{"https://www.google.com:443/search", "google.com"},
+		{"http://example.com./", "example.com"},
+		{"http://example。com", "example.com"},
+		{"https://bücher.de", "xn--bcher-kva.de"},
+		{"steam://run/123", "run"},
+		{"http://%zz", ""},
+	}
+
+	for _, c := range cases {
+		if got := linkHost(c.link); got != c.expected {
+			t.Errorf("linkHost(%q) = %q, expected %q", c.link, got, c.expected)
+		}
+	}
+}
+
+func TestMatchesDomain(t *testing.T) {
+	domains := compileDomains("example.com https://www.Google.com/ sub.example.org")
+
+	cases := []struct {
+		host     string
+		expected bool
+	}{
+		{"example.com", true},
+		{"a.b.example.com", true},
+		{"google.com", true},
+		{"maps.google.com", true},
+		{"sub.example.org", true},
+		{"deep.sub.example.org", true},
+		{"example.org", false},
+		{"notexample.com", false},
+		{"example.com.evil.com", false},
+		{"com", false},
+		{"", false},
+	}
+
+	for _, c := range cases {
+		if got := matchesDomain(c.host, domains); got != c.expected {
+			t.Errorf("matchesDomain(%q) = %t, expected %t", c.host, got, c.expected)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package automod
+
+// Channel overrides, replaces the server wide settings of some of the rules in a channel
+
+import (
+	"encoding/json"
+	"github.com/Sirupsen/logrus"
+	"github.com/fzzy/radix/redis"
+	"github.com/jonas747/yagpdb/bot"
+	"github.com/patrickmn/go-cache"
+	"reflect"
+)
+
+type ChannelOverride struct {
+	ChannelID string `json:"channel_id"`
+	// Names of the overridden rules, the rest use the server wide settings
+	Rules []string `json:"rules"`
+	// The settings of the overridden rules, the rest of the config is not used
+	Config *Config `json:"config"`
+}
+
+// RulesInChannel returns the rules with the overridden ones replaced by the override settings
+func (c *Config) RulesInChannel(override *ChannelOverride) []Rule {
+	rules := c.Rules()
+	if override == nil || override.Config == nil || len(override.Rules) < 1 {
+		return rules
+	}
+
+	// Both are in the same order
+	overridden := override.Config.Rules()
+	for i, r := range rules {
+		if containsString(override.Rules, r.Name()) {
+			rules[i] = overridden[i]
+		}
+	}
+
+	return rules
+}
+
+// Sets the rules that are nil (stored as null) to the defaults
+func (c *Config) fillDefaults() {
+	v := reflect.ValueOf(c).Elem()
+	defaults := reflect.ValueOf(NewConfig()).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		if field.Kind() == reflect.Ptr && field.IsNil() {
+			field.Set(defaults.Field(i))
+		}
+	}
+}
+
+func (o *ChannelOverride) Save(client *redis.Client, guildID string) error {
+	serialized, err := json.Marshal(o)
+	if err != nil {
+		return err
+	}
+
+	return client.Cmd("HSET", KeyChannelOverrides(guildID), o.ChannelID, serialized).Err
+}
+
+// GetChannelOverrides returns the channel overrides of the guild by channel id
+func GetChannelOverrides(client *redis.Client, guildID string) (map[string]*ChannelOverride, error) {
+	hash, err := client.Cmd("HGETALL", KeyChannelOverrides(guildID)).Hash()
+	if err != nil {
+		if _, ok := err.(*redis.CmdError); ok {
+			return map[string]*ChannelOverride{}, nil
+		}
+		return nil, err
+	}
+
+	result := make(map[string]*ChannelOverride)
+	for k, raw := range hash {
+		// Start from the defaults, so that rules added after the override was saved are not nil
+		decoded := &ChannelOverride{Config: NewConfig()}
+		err = json.Unmarshal([]byte(raw), decoded)
+		if err != nil {
+			logrus.WithError(err).WithField("guild", guildID).WithField("channel", k).Error("Failed decoding automod channel override")
+			continue
+		}
+
+		if decoded.Config == nil {
+			logrus.WithField("guild", guildID).WithField("channel", k).Error("Automod channel override without a config, ignoring it")
+			continue
+		}
+
+		decoded.Config.fillDefaults()
+		decoded.Config.compileRules()
+		result[k] = decoded
+	}
+
+	return result, nil
+}
+
+// CachedGetChannelOverride returns the override of the channel using the local bot cache, nil if there is none
+func CachedGetChannelOverride(client *redis.Client, guildID, channelID string) (*ChannelOverride, error) {
+	if overrides, ok := bot.Cache.Get(KeyChannelOverridesCache(guildID)); ok {
+		return overrides.(map[string]*ChannelOverride)[channelID], nil
+	}
+
+	overrides, err := GetChannelOverrides(client, guildID)
+	if err != nil {
+		return nil, err
+	}
+
+	bot.Cache.Set(KeyChannelOverridesCache(guildID), overrides, cache.DefaultExpiration)
+	return overrides[channelID], nil
+}
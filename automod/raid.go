@@ -0,0 +1,249 @@
+package automod
+
+// Raid protection, puts the server in lockdown when too many (new) accounts join in a short time
+
+import (
+	"fmt"
+	"github.com/Sirupsen/logrus"
+	"github.com/fzzy/radix/redis"
+	"github.com/jonas747/discordgo"
+	"github.com/jonas747/yagpdb/common"
+	"strings"
+	"time"
+)
+
+// Actions taken on raiders
+const (
+	RaidActionNone = iota
+	RaidActionKick
+	RaidActionBan
+)
+
+type RaidProtection struct {
+	Enabled bool
+
+	// Lockdown when this many members joins within JoinsWithin seconds
+	JoinThreshold int `valid:"0,1000"`
+	JoinsWithin   int `valid:"0,3600"`
+
+	// Only count and act on accounts younger than this many days, 0 for all accounts
+	MaxAccountAgeDays int `valid:"0,365"`
+
+	// What to do with the joiners that triggered the lockdown and the ones joining during it
+	Action int `valid:"0,2"`
+	// Raise the verification level of the server during the lockdown
+	RaiseVerification bool
+
+	// Minutes until the lockdown is lifted
+	LockdownDuration int `valid:"0,1440"`
+
+	AlertChannel string `valid:"channel,true"`
+	// Mentioned in the alerts
+	AlertRole string `valid:"role,true"`
+}
+
+// The data of the "automod_raid_end" scheduled event
+type RaidEndEvtData struct {
+	GuildID string `json:"guild_id"`
+	// The verification level before the lockdown, -1 if it wasn't changed
+	PrevVerificationLevel int `json:"prev_verification_level"`
+}
+
+// Returns true if the account is young enough to be considered as part of a raid
+func (r *RaidProtection) isSuspicious(user *discordgo.User) bool {
+	if r.MaxAccountAgeDays < 1 {
+		return true
+	}
+
+	return time.Since(common.SnowflakeTime(user.ID)) < time.Duration(r.MaxAccountAgeDays)*time.Hour*24
+}
+
+// Returns the join window in seconds
+func (r *RaidProtection) joinsWithin() int {
+	if r.JoinsWithin < 1 {
+		return 10
+	}
+	return r.JoinsWithin
+}
+
+func (r *RaidProtection) lockdownDuration() time.Duration {
+	if r.LockdownDuration < 1 {
+		return time.Minute * 10
+	}
+	return time.Duration(r.LockdownDuration) * time.Minute
+}
+
+func HandleGuildMemberAdd(s *discordgo.Session, evt *discordgo.GuildMemberAdd, client *redis.Client) {
+	config, err := CachedGetConfig(client, evt.GuildID)
+	if err != nil {
+		logrus.WithError(err).WithField("guild", evt.GuildID).Error("Failed retrieving config")
+		return
+	}
+
+	raid := config.Raid
+	if !config.Enabled || raid == nil || !raid.Enabled || raid.JoinThreshold < 1 || evt.User.Bot {
+		return
+	}
+
+	if !raid.isSuspicious(evt.User) {
+		return
+	}
+
+	inLockdown, err := client.Cmd("EXISTS", KeyRaidLockdown(evt.GuildID)).Bool()
+	if err != nil {
+		logrus.WithError(err).WithField("guild", evt.GuildID).Error("Failed checking raid lockdown")
+		return
+	}
+
+	if inLockdown {
+		raidAct(s, raid, evt.GuildID, []string{evt.User.ID})
+		return
+	}
+
+	within := raid.joinsWithin()
+
+	now := time.Now().Unix()
+	key := KeyRaidJoins(evt.GuildID)
+
+	client.Append("ZADD", key, now, evt.User.ID)
+	client.Append("ZREMRANGEBYSCORE", key, "-inf", now-int64(within))
+	client.Append("ZRANGE", key, 0, -1)
+	client.Append("EXPIRE", key, within)
+
+	replies, err := common.GetRedisReplies(client, 4)
+	if err != nil {
+		logrus.WithError(err).WithField("guild", evt.GuildID).Error("Failed recording join")
+		return
+	}
+
+	joined, err := replies[2].List()
+	if err != nil || len(joined) < raid.JoinThreshold {
+		return
+	}
+
+	startLockdown(s, client, raid, evt.GuildID, joined)
+}
+
+func startLockdown(s *discordgo.Session, client *redis.Client, raid *RaidProtection, guildID string, joined []string) {
+	duration := raid.lockdownDuration()
+
+	// NX so that only one join starts it
+	reply := client.Cmd("SET", KeyRaidLockdown(guildID), time.Now().Unix(), "EX", int(duration.Seconds()), "NX")
+	if reply.Err != nil {
+		logrus.WithError(reply.Err).WithField("guild", guildID).Error("Failed starting raid lockdown")
+		return
+	}
+	if reply.Type == redis.NilReply {
+		return // Already in lockdown
+	}
+
+	client.Cmd("DEL", KeyRaidJoins(guildID))
+
+	guild, err := s.State.Guild(guildID)
+	if err != nil {
+		logrus.WithError(err).WithField("guild", guildID).Error("Guild not found in state")
+		return
+	}
+
+	notes := make([]string, 0)
+
+	prevLevel := -1
+	if raid.RaiseVerification && guild.VerificationLevel < discordgo.VerificationLevelHigh {
+		high := discordgo.VerificationLevelHigh
+		_, err = s.GuildEdit(guildID, discordgo.GuildParams{VerificationLevel: &high})
+		if err != nil {
+			logrus.WithError(err).WithField("guild", guildID).Error("Failed raising verification level")
+			notes = append(notes, "Failed raising the verification level: "+err.Error())
+		} else {
+			prevLevel = int(guild.VerificationLevel)
+			notes = append(notes, "The verification level was raised to high.")
+		}
+	}
+
+	_, err = common.ScheduleUniqueEvent(client, "automod_raid_end", guildID, &RaidEndEvtData{GuildID: guildID, PrevVerificationLevel: prevLevel}, time.Now().Add(duration))
+	if err != nil {
+		logrus.WithError(err).WithField("guild", guildID).Error("Failed scheduling the end of raid lockdown")
+	}
+
+	switch raid.Action {
+	case RaidActionKick:
+		notes = append(notes, "New members are being kicked.")
+	case RaidActionBan:
+		notes = append(notes, "New members are being banned.")
+	}
+
+	sendRaidAlert(s, raid, fmt.Sprintf("**Raid protection:** %d members joined within %d seconds, the server is in lockdown for %d minutes.\n%s",
+		len(joined), raid.joinsWithin(), int(duration.Minutes()), strings.Join(notes, "\n")))
+
+	raidAct(s, raid, guildID, joined)
+}
+
+// Kicks or bans the users depending on the raid action
+func raidAct(s *discordgo.Session, raid *RaidProtection, guildID string, userIDs []string) {
+	for _, id := range userIDs {
+		var err error
+		switch raid.Action {
+		case RaidActionKick:
+			err = s.GuildMemberDelete(guildID, id)
+		case RaidActionBan:
+			err = s.GuildBanCreate(guildID, id, 1)
+		default:
+			return
+		}
+
+		if err != nil {
+			logrus.WithError(err).WithField("guild", guildID).WithField("user", id).Error("Failed carrying out raid action")
+		}
+	}
+}
+
+func sendRaidAlert(s *discordgo.Session, raid *RaidProtection, msg string) {
+	if raid.AlertChannel == "" {
+		return
+	}
+
+	if raid.AlertRole != "" {
+		msg = "<@&" + raid.AlertRole + "> " + msg
+	}
+
+	_, err := s.ChannelMessageSend(raid.AlertChannel, msg)
+	if err != nil {
+		logrus.WithError(err).WithField("channel", raid.AlertChannel).Error("Failed sending raid alert")
+	}
+}
+
+func handleRaidEnd(evt *common.ScheduledEvent) error {
+	var data RaidEndEvtData
+	err := evt.DecodeData(&data)
+	if err != nil {
+		logrus.WithError(err).Error("Invalid raid end event")
+		return nil
+	}
+
+	if data.PrevVerificationLevel >= 0 {
+		level := discordgo.VerificationLevel(data.PrevVerificationLevel)
+		_, err = common.BotSession.GuildEdit(data.GuildID, discordgo.GuildParams{VerificationLevel: &level})
+		if err != nil {
+			return err
+		}
+	}
+
+	client, err := common.RedisPool.Get()
+	if err != nil {
+		return err
+	}
+	defer common.RedisPool.Put(client)
+
+	client.Cmd("DEL", KeyRaidLockdown(data.GuildID))
+
+	config, err := GetConfig(client, data.GuildID)
+	if err != nil {
+		return err
+	}
+
+	if config.Raid != nil {
+		sendRaidAlert(common.BotSession, config.Raid, "**Raid protection:** The lockdown has ended.")
+	}
+
+	return nil
+}
@@ -1,14 +1,21 @@
 package automod
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
 	"github.com/Sirupsen/logrus"
 	"github.com/fzzy/radix/redis"
 	"github.com/jonas747/discordgo"
 	"github.com/jonas747/yagpdb/common"
-	"net/url"
+	"mime"
+	"net/http"
+	"path"
 	"regexp"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 type Punishment int
@@ -21,9 +28,42 @@ const (
 )
 
 type Rule interface {
+	// Name is the name of the config field of the rule, used to identify it in the violation history
+	Name() string
 	Check(m *discordgo.Message, channel *discordgo.Channel, client *redis.Client) (del bool, punishment Punishment, msg string, err error)
 	ShouldIgnore(msg *discordgo.Message, m *discordgo.Member) bool
-	GetMuteDuration() int
+	GetBase() *BaseRule
+}
+
+// MemberRule is implemented by rules that also needs the member that sent the message
+type MemberRule interface {
+	CheckMember(m *discordgo.Message, member *discordgo.Member, channel *discordgo.Channel, client *redis.Client) (del bool, punishment Punishment, msg string, err error)
+}
+
+// Human readable names of the rules, by their Name
+var RuleDisplayNames = map[string]string{
+	"Spam":        "Spam",
+	"Duplicate":   "Duplicate messages",
+	"Invite":      "Server invites",
+	"Mention":     "Mass mention",
+	"Links":       "Links",
+	"Words":       "Banned words",
+	"Sites":       "Banned websites",
+	"Caps":        "Caps",
+	"Emoji":       "Emoji",
+	"Zalgo":       "Zalgo",
+	"CharFlood":   "Character flood",
+	"Attachments": "Attachments",
+	"NewMembers":  "New members",
+	"Custom":      "Custom rules",
+}
+
+// RuleDisplayName returns the human readable name of a rule, or name itself if unknown
+func RuleDisplayName(name string) string {
+	if display, ok := RuleDisplayNames[name]; ok {
+		return display
+	}
+	return name
 }
 
 type BaseRule struct {
@@ -34,16 +74,24 @@ type BaseRule struct {
 
 	// Execute these punishments after certain number of repeated violaions
 	MuteAfter    int `valid:"0,100"`
-	MuteDuration int `valid:"0,100"`
+	MuteDuration int `valid:"0,525600"` // minutes
 	KickAfter    int `valid:"0,100"`
 	BanAfter     int `valid:"0,100"`
+	BanDuration  int `valid:"0,525600"` // minutes, 0 for permanent
+
+	// Leave the message instead of deleting it
+	KeepMessage bool
+	// Don't DM the user a warning when there's no other punishment
+	DisableWarning bool
+	// Custom warning DM, the rules default message is used if empty
+	WarningMessage string `valid:"template,1000"`
 
 	IgnoreRole     string   `valid:"role,true"`
 	IgnoreChannels []string `valid:"channel,false"`
 }
 
-func (r BaseRule) GetMuteDuration() int {
-	return r.MuteDuration
+func (r *BaseRule) GetBase() *BaseRule {
+	return r
 }
 
 func (r BaseRule) PushViolation(client *redis.Client, key string) (p Punishment, err error) {
@@ -98,6 +146,8 @@ type SpamRule struct {
 	Within      int `valid:"0,100"`
 }
 
+func (s *SpamRule) Name() string { return "Spam" }
+
 // Triggers when a certain number of messages is found by the same author within a timeframe
 func (s *SpamRule) Check(evt *discordgo.Message, channel *discordgo.Channel, client *redis.Client) (del bool, punishment Punishment, msg string, err error) {
 
@@ -141,11 +191,138 @@ func (s *SpamRule) Check(evt *discordgo.Message, channel *discordgo.Channel, cli
 	return
 }
 
+type DuplicateRule struct {
+	BaseRule `valid:"traverse"`
+
+	// Number of times the same message has to be sent within the timeframe to trigger
+	NumRepeats int `valid:"0,100"`
+	Within     int `valid:"0,3600"`
+
+	// Count repeats across all channels instead of per channel
+	AcrossChannels bool
+	// Messages shorter than this (after normalization) are ignored, so that "ok" and "lol" don't trigger it
+	MinLength int `valid:"0,2000"`
+}
+
+func (d *DuplicateRule) Name() string { return "Duplicate" }
+
+// Triggers when the same user sends the same message a certain number of times within a timeframe
+func (d *DuplicateRule) Check(evt *discordgo.Message, channel *discordgo.Channel, client *redis.Client) (del bool, punishment Punishment, msg string, err error) {
+	if d.NumRepeats < 2 {
+		return
+	}
+
+	fingerprint := duplicateFingerprint(evt.Content, d.MinLength)
+	if fingerprint == "" {
+		return
+	}
+
+	if !d.AcrossChannels {
+		fingerprint = channel.ID + ":" + fingerprint
+	}
+
+	within := d.Within
+	if within < 1 {
+		within = 60
+	}
+
+	now := time.Now().Unix()
+	key := KeyDuplicateMessages(channel.GuildID, evt.Author.ID, fingerprint)
+
+	// The message id as member so that edits aren't counted as repeats
+	client.Append("ZADD", key, now, evt.ID)
+	client.Append("ZREMRANGEBYSCORE", key, "-inf", now-int64(within))
+	client.Append("ZCARD", key)
+	client.Append("EXPIRE", key, within)
+
+	replies, err := common.GetRedisReplies(client, 4)
+	if err != nil {
+		return
+	}
+
+	repeats, err := replies[2].Int()
+	if err != nil || repeats < d.NumRepeats {
+		return
+	}
+
+	del = true
+
+	punishment, err = d.PushViolation(client, KeyViolations(channel.GuildID, evt.Author.ID, "duplicate"))
+	if err != nil {
+		return
+	}
+
+	msg = "Sending the same message repeatedly."
+	return
+}
+
+// Returns a fingerprint of the normalized message, ignoring case, punctuation and whitespace
+// Returns a empty string if the message is shorter than minLength
+func duplicateFingerprint(content string, minLength int) string {
+	normalized := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, content)
+
+	// Only emojis or punctuation
+	if normalized == "" {
+		normalized = strings.Join(strings.Fields(strings.ToLower(content)), " ")
+	}
+
+	if normalized == "" || utf8.RuneCountInString(normalized) < minLength {
+		return ""
+	}
+
+	hash := sha1.Sum([]byte(normalized))
+	return hex.EncodeToString(hash[:])
+}
+
 type InviteRule struct {
 	BaseRule `valid:"traverse"`
+
+	// Whitespace separated ids of partner servers that can be invited to
+	AllowedGuilds string `valid:",10000"`
+	// Whitespace separated invite codes that are always allowed, such as vanity urls
+	AllowedCodes string `valid:",10000"`
+
+	compiledGuilds map[string]bool
+	compiledCodes  map[string]bool
 }
 
-var inviteRegex = regexp.MustCompile(`discord\.gg(?:\/#)?(?:\/invite)?\/([a-zA-Z0-9-]+)`)
+// Matches discord.gg/code, discord.gg/invite/code, discord.com/invite/code, discordapp.com/invite/code
+// and the shortened forms through third party services, also with spaces around the separators ("discord . gg / code")
+var inviteRegex = regexp.MustCompile(`(?i)(discord(?:app)?\s*\.\s*com\s*\/\s*invite|discord\s*\.\s*gg(?:\s*\/\s*#)?(?:\s*\/\s*invite)?|discord\s*\.\s*(?:io|me|li|link|plus)|dsc\s*\.\s*gg|invite\s*\.\s*gg)\s*\/\s*([a-zA-Z0-9-]+)`)
+
+// Domains that resolve to official discord invites, codes on other (shortener) domains can't be looked up
+var officialInviteDomain = regexp.MustCompile(`(?i)^discord(?:app)?\s*\.\s*(?:gg|com)`)
+
+// How long invite lookups are cached
+const (
+	inviteCacheValid   = 60 * 60
+	inviteCacheInvalid = 60 * 10
+)
+
+func (i *InviteRule) GetCompiled() (guilds map[string]bool, codes map[string]bool) {
+	if i.compiledGuilds != nil {
+		return i.compiledGuilds, i.compiledCodes
+	}
+
+	i.compiledGuilds = make(map[string]bool)
+	for _, field := range strings.Fields(i.AllowedGuilds) {
+		i.compiledGuilds[field] = true
+	}
+
+	i.compiledCodes = make(map[string]bool)
+	for _, field := range strings.Fields(i.AllowedCodes) {
+		i.compiledCodes[strings.ToLower(field)] = true
+	}
+
+	return i.compiledGuilds, i.compiledCodes
+}
+
+func (i *InviteRule) Name() string { return "Invite" }
 
 func (i *InviteRule) Check(evt *discordgo.Message, channel *discordgo.Channel, client *redis.Client) (del bool, punishment Punishment, msg string, err error) {
 	matches := inviteRegex.FindAllStringSubmatch(evt.ContentWithMentionsReplaced(), -1)
@@ -153,16 +330,18 @@ func (i *InviteRule) Check(evt *discordgo.Message, channel *discordgo.Channel, c
 		return
 	}
 
+	allowedGuilds, allowedCodes := i.GetCompiled()
+
 	checked := make([]string, 0)
 
 	badInvite := false
 
 OUTER:
 	for _, v := range matches {
-		if len(v) < 2 {
+		if len(v) < 3 {
 			continue
 		}
-		id := v[1]
+		id := v[2]
 
 		// only check each link once
 		for _, c := range checked {
@@ -173,14 +352,24 @@ OUTER:
 
 		checked = append(checked, id)
 
-		invite, err := common.BotSession.Invite(id)
+		if allowedCodes[strings.ToLower(id)] {
+			continue
+		}
+
+		// Can't tell where links through a shortener leads, so only the allowed codes are let through
+		if !officialInviteDomain.MatchString(v[1]) {
+			badInvite = true
+			break
+		}
+
+		guildID, err := InviteGuild(client, id)
 		if err != nil {
-			logrus.Error(err)
+			logrus.WithError(err).WithField("invite", id).Error("Failed looking up invite")
 			continue
 		}
 
-		// Ignore invites to this server
-		if invite.Guild.ID == channel.GuildID {
+		// Ignore invalid invites, invites to this server and partner servers
+		if guildID == "" || guildID == channel.GuildID || allowedGuilds[guildID] {
 			continue
 		}
 
@@ -203,12 +392,42 @@ OUTER:
 	return
 }
 
+// InviteGuild returns the id of the server the invite code is for, or an empty string if the invite is invalid
+// Lookups are cached in redis to avoid hitting the api for every message
+func InviteGuild(client *redis.Client, code string) (string, error) {
+	reply := client.Cmd("GET", KeyInviteGuild(code))
+	if reply.Type != redis.NilReply {
+		return reply.Str()
+	}
+
+	guildID := ""
+	expire := inviteCacheValid
+
+	invite, err := common.BotSession.Invite(code)
+	if err != nil {
+		cast, ok := err.(*discordgo.RESTError)
+		if !ok || cast.Response == nil || cast.Response.StatusCode != http.StatusNotFound {
+			return "", err
+		}
+
+		// Unknown or expired invite
+		expire = inviteCacheInvalid
+	} else if invite.Guild != nil {
+		guildID = invite.Guild.ID
+	}
+
+	err = client.Cmd("SET", KeyInviteGuild(code), guildID, "EX", expire).Err
+	return guildID, err
+}
+
 type MentionRule struct {
 	BaseRule `valid:"traverse"`
 
 	Treshold int `valid:"0,500"`
 }
 
+func (m *MentionRule) Name() string { return "Mention" }
+
 func (m *MentionRule) Check(evt *discordgo.Message, channel *discordgo.Channel, client *redis.Client) (del bool, punishment Punishment, msg string, err error) {
 	if len(evt.Mentions) < m.Treshold {
 		return
@@ -226,13 +445,36 @@ func (m *MentionRule) Check(evt *discordgo.Message, channel *discordgo.Channel,
 
 type LinksRule struct {
 	BaseRule `valid:"traverse"`
+
+	// Whitespace separated, if set only links to these domains (and their subdomains) are allowed
+	AllowedDomains  string `valid:",10000"`
+	compiledDomains map[string]bool
+}
+
+func (l *LinksRule) GetCompiled() map[string]bool {
+	if l.compiledDomains != nil {
+		return l.compiledDomains
+	}
+
+	l.compiledDomains = compileDomains(l.AllowedDomains)
+	return l.compiledDomains
 }
 
-var linkRegex = regexp.MustCompile(`^((https?|steam):\/\/[^\s<]+[^<.,:;"')\]\s])`)
+func (l *LinksRule) Name() string { return "Links" }
 
 func (l *LinksRule) Check(evt *discordgo.Message, channel *discordgo.Channel, client *redis.Client) (del bool, punishment Punishment, msg string, err error) {
 
-	if !linkRegex.MatchString(evt.ContentWithMentionsReplaced()) {
+	allowed := l.GetCompiled()
+
+	badLink := false
+	for _, link := range messageLinks(evt, false) {
+		if len(allowed) < 1 || !matchesDomain(linkHost(link), allowed) {
+			badLink = true
+			break
+		}
+	}
+
+	if !badLink {
 		return
 	}
 
@@ -242,7 +484,11 @@ func (l *LinksRule) Check(evt *discordgo.Message, channel *discordgo.Channel, cl
 		return
 	}
 
-	msg = "You do not have permission to send links"
+	if len(allowed) > 0 {
+		msg = "You do not have permission to send links to that website"
+	} else {
+		msg = "You do not have permission to send links"
+	}
 
 	return
 }
@@ -250,44 +496,31 @@ func (l *LinksRule) Check(evt *discordgo.Message, channel *discordgo.Channel, cl
 type WordsRule struct {
 	BaseRule          `valid:"traverse"`
 	BuiltinSwearWords bool
-	BannedWords       string          `valid:",10000"`
-	compiledWords     map[string]bool `json:"-"`
-}
+	// Whitespace separated, * can be used as a wildcard
+	BannedWords string `valid:",10000"`
+	// One per line
+	BannedPhrases string `valid:",10000"`
+	BannedRegexes string `valid:"regexlines,10000"`
 
-func (w *WordsRule) GetCompiled() map[string]bool {
-	if w.compiledWords != nil {
-		return w.compiledWords
-	}
+	compiled *WordFilter `json:"-"`
+}
 
-	w.compiledWords = make(map[string]bool)
-	fields := strings.Fields(w.BannedWords)
-	for _, word := range fields {
-		w.compiledWords[word] = true
+func (w *WordsRule) GetCompiled() *WordFilter {
+	if w.compiled != nil {
+		return w.compiled
 	}
 
-	return w.compiledWords
+	w.compiled = NewWordFilter(strings.Fields(w.BannedWords), strings.Split(w.BannedPhrases, "\n"), strings.Split(w.BannedRegexes, "\n"))
+	return w.compiled
 }
 
-func (w *WordsRule) Check(evt *discordgo.Message, channel *discordgo.Channel, client *redis.Client) (del bool, punishment Punishment, msg string, err error) {
+func (w *WordsRule) Name() string { return "Words" }
 
-	found := false
-
-	userBanned := w.GetCompiled()
-
-	lower := strings.ToLower(evt.Content)
-	messageWords := strings.Fields(lower)
-	for _, v := range messageWords {
-		if _, ok := userBanned[v]; ok {
-			found = true
-			break
-		}
+func (w *WordsRule) Check(evt *discordgo.Message, channel *discordgo.Channel, client *redis.Client) (del bool, punishment Punishment, msg string, err error) {
 
-		if w.BuiltinSwearWords {
-			if _, ok := BuiltinSwearWords[v]; ok {
-				found = true
-				break
-			}
-		}
+	found := w.GetCompiled().Match(evt.Content)
+	if !found && w.BuiltinSwearWords {
+		found = BuiltinSwearFilter().Match(evt.Content)
 	}
 
 	if !found {
@@ -308,6 +541,7 @@ type SitesRule struct {
 	BuiltinBadSites  bool
 	BuiltinPornSites bool
 
+	// Whitespace separated, subdomains of the banned sites are also banned
 	BannedWebsites   string `valid:",10000"`
 	compiledWebsites map[string]bool
 }
@@ -317,31 +551,48 @@ func (w *SitesRule) GetCompiled() map[string]bool {
 		return w.compiledWebsites
 	}
 
-	w.compiledWebsites = make(map[string]bool)
-	fields := strings.Fields(w.BannedWebsites)
-	for _, field := range fields {
-		w.compiledWebsites[field] = true
-	}
-
+	w.compiledWebsites = compileDomains(w.BannedWebsites)
 	return w.compiledWebsites
 }
 
+func (s *SitesRule) Name() string { return "Sites" }
+
 func (s *SitesRule) Check(evt *discordgo.Message, channel *discordgo.Channel, client *redis.Client) (del bool, punishment Punishment, msg string, err error) {
-	matches := linkRegex.FindAllString(evt.Content, -1)
+	bannedLinks := s.GetCompiled()
+	lists := GetBlocklists()
 
 	bannedLink := false
+	for _, v := range messageLinks(evt, true) {
+		host := linkHost(v)
+		if host == "" {
+			continue
+		}
+
+		hosts := []string{host}
+		if matchesDomain(host, lists.Shorteners) {
+			// Resolved by CheckMessage before the rules are checked
+			resolved, err := CachedShortLink(client, v)
+			if err != nil {
+				logrus.WithError(err).WithField("link", v).Error("Failed retrieving short link")
+			}
+			if resolvedHost := linkHost(resolved); resolvedHost != "" && resolvedHost != host {
+				hosts = append(hosts, resolvedHost)
+			}
+		}
+
+		for _, h := range hosts {
+			if matchesDomain(h, bannedLinks) ||
+				(s.BuiltinBadSites && (matchesDomain(h, lists.Bad) || lists.LookalikeOf(h) != "")) ||
+				(s.BuiltinPornSites && matchesDomain(h, lists.Porn)) {
 
-	bannedLinks := s.GetCompiled()
-	for _, v := range matches {
-		parsed, err := url.ParseRequestURI(v)
-		if err != nil {
-			logrus.WithError(err).WithField("url", v).Error("Failed parsing request url matched with regex")
-		} else {
-			if _, ok := bannedLinks[strings.ToLower(parsed.Host)]; ok {
 				bannedLink = true
 				break
 			}
 		}
+
+		if bannedLink {
+			break
+		}
 	}
 
 	if !bannedLink {
@@ -353,3 +604,382 @@ func (s *SitesRule) Check(evt *discordgo.Message, channel *discordgo.Channel, cl
 	del = true
 	return
 }
+
+// Matches custom emojis, <:name:id> and animated ones <a:name:id>
+var customEmojiRegex = regexp.MustCompile(`<a?:[a-zA-Z0-9_]+:\d+>`)
+
+type CapsRule struct {
+	BaseRule `valid:"traverse"`
+
+	// Messages with fewer letters than this are ignored
+	MinLength int `valid:"0,2000"`
+	// Max percentage of the letters that can be upper case
+	MaxPercentage int `valid:"0,100"`
+}
+
+func (c *CapsRule) Name() string { return "Caps" }
+
+// Triggers when too much of a message is in upper case
+func (c *CapsRule) Check(evt *discordgo.Message, channel *discordgo.Channel, client *redis.Client) (del bool, punishment Punishment, msg string, err error) {
+	content := customEmojiRegex.ReplaceAllString(evt.Content, "")
+
+	letters := 0
+	upper := 0
+	for _, r := range content {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+
+		letters++
+		if unicode.IsUpper(r) {
+			upper++
+		}
+	}
+
+	if letters < 1 || letters < c.MinLength {
+		return
+	}
+
+	if upper*100 <= letters*c.MaxPercentage {
+		return
+	}
+
+	del = true
+	punishment, err = c.PushViolation(client, KeyViolations(channel.GuildID, evt.Author.ID, "caps"))
+	if err != nil {
+		return
+	}
+
+	msg = "Sending messages in all caps."
+	return
+}
+
+type EmojiRule struct {
+	BaseRule `valid:"traverse"`
+
+	MaxEmojis int `valid:"0,2000"`
+}
+
+func (e *EmojiRule) Name() string { return "Emoji" }
+
+// Triggers when a message has more emojis than allowed, both unicode and custom ones
+func (e *EmojiRule) Check(evt *discordgo.Message, channel *discordgo.Channel, client *redis.Client) (del bool, punishment Punishment, msg string, err error) {
+	if countEmojis(evt.Content) <= e.MaxEmojis {
+		return
+	}
+
+	del = true
+	punishment, err = e.PushViolation(client, KeyViolations(channel.GuildID, evt.Author.ID, "emoji"))
+	if err != nil {
+		return
+	}
+
+	msg = "Sending too many emojis."
+	return
+}
+
+// Counts the unicode and custom emojis in s, emojis joined with zero width joiners and flags count as one
+func countEmojis(s string) int {
+	count := len(customEmojiRegex.FindAllStringIndex(s, -1))
+
+	prevZWJ := false
+	regionalIndicators := 0
+	for _, r := range s {
+		switch {
+		case r == 0x200D: // Zero width joiner
+			prevZWJ = true
+			continue
+		case r == 0xFE0F || (r >= 0x1F3FB && r <= 0x1F3FF): // Variation selector and skin tones modify the previous emoji
+			continue
+		case r >= 0x1F1E6 && r <= 0x1F1FF: // Regional indicators, 2 of them make a flag
+			regionalIndicators++
+			if regionalIndicators%2 == 1 {
+				count++
+			}
+		case isEmojiRune(r):
+			if !prevZWJ {
+				count++
+			}
+		}
+
+		prevZWJ = false
+	}
+
+	return count
+}
+
+func isEmojiRune(r rune) bool {
+	return (r >= 0x1F000 && r <= 0x1FAFF) || // Mahjong and cards up to the supplemental symbols and pictographs
+		(r >= 0x2600 && r <= 0x27BF) || // Misc symbols and dingbats
+		(r >= 0x2B00 && r <= 0x2BFF) // Arrows and stars like ⭐
+}
+
+type ZalgoRule struct {
+	BaseRule `valid:"traverse"`
+
+	// Max number of combining characters (the ones stacking on top of eachother in zalgo) in a message
+	MaxCombining int `valid:"0,2000"`
+}
+
+func (z *ZalgoRule) Name() string { return "Zalgo" }
+
+// Triggers on zalgo text, which abuses combining characters
+func (z *ZalgoRule) Check(evt *discordgo.Message, channel *discordgo.Channel, client *redis.Client) (del bool, punishment Punishment, msg string, err error) {
+	combining := 0
+	for _, r := range evt.Content {
+		if unicode.In(r, unicode.Mn, unicode.Me) {
+			combining++
+		}
+	}
+
+	if combining <= z.MaxCombining {
+		return
+	}
+
+	del = true
+	punishment, err = z.PushViolation(client, KeyViolations(channel.GuildID, evt.Author.ID, "zalgo"))
+	if err != nil {
+		return
+	}
+
+	msg = "Sending zalgo text."
+	return
+}
+
+type CharFloodRule struct {
+	BaseRule `valid:"traverse"`
+
+	// Max number of times the same character can be repeated in a row
+	MaxRepeated int `valid:"0,2000"`
+}
+
+func (c *CharFloodRule) Name() string { return "CharFlood" }
+
+// Triggers when the same character is repeated too many times in a row, like "aaaaaaaaaaaaaaaaaaaaaa"
+func (c *CharFloodRule) Check(evt *discordgo.Message, channel *discordgo.Channel, client *redis.Client) (del bool, punishment Punishment, msg string, err error) {
+	if c.MaxRepeated < 1 {
+		return
+	}
+
+	longest := 0
+	current := 0
+	var last rune
+	for _, r := range evt.Content {
+		if r == last && !unicode.IsSpace(r) {
+			current++
+		} else {
+			current = 1
+			last = r
+		}
+
+		if current > longest {
+			longest = current
+		}
+	}
+
+	if longest <= c.MaxRepeated {
+		return
+	}
+
+	del = true
+	punishment, err = c.PushViolation(client, KeyViolations(channel.GuildID, evt.Author.ID, "charflood"))
+	if err != nil {
+		return
+	}
+
+	msg = "Flooding the chat with repeated characters."
+	return
+}
+
+type AttachmentRule struct {
+	BaseRule `valid:"traverse"`
+
+	// Whitespace separated file extensions ("exe") or mime types ("application/zip", "video/*")
+	BlockedTypes string `valid:",2000"`
+	// If set, only these types are allowed
+	AllowedTypes string `valid:",2000"`
+
+	// 0 for no limit
+	MaxFileSizeKB  int `valid:"0,102400"`
+	MaxAttachments int `valid:"0,10"`
+
+	ImagesOnlyChannels []string `valid:"channel,true"`
+	NoImagesChannels   []string `valid:"channel,true"`
+
+	compiledBlocked *fileTypeList
+	compiledAllowed *fileTypeList
+}
+
+// A list of file extensions and mime types
+type fileTypeList struct {
+	extensions map[string]bool
+	// Mime types, or the prefix of them for wildcards ("video/")
+	mimeTypes []string
+}
+
+func newFileTypeList(list string) *fileTypeList {
+	l := &fileTypeList{extensions: make(map[string]bool)}
+	for _, field := range strings.Fields(strings.ToLower(list)) {
+		if strings.Contains(field, "/") {
+			l.mimeTypes = append(l.mimeTypes, strings.TrimSuffix(field, "*"))
+			continue
+		}
+
+		l.extensions[strings.TrimLeft(field, "*.")] = true
+	}
+	return l
+}
+
+func (l *fileTypeList) Empty() bool {
+	return len(l.extensions) < 1 && len(l.mimeTypes) < 1
+}
+
+func (l *fileTypeList) Matches(ext, mimeType string) bool {
+	if ext != "" && l.extensions[ext] {
+		return true
+	}
+
+	if mimeType == "" {
+		return false
+	}
+
+	for _, t := range l.mimeTypes {
+		if t == mimeType || (strings.HasSuffix(t, "/") && strings.HasPrefix(mimeType, t)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *AttachmentRule) GetCompiled() (blocked *fileTypeList, allowed *fileTypeList) {
+	if a.compiledBlocked != nil {
+		return a.compiledBlocked, a.compiledAllowed
+	}
+
+	a.compiledBlocked = newFileTypeList(a.BlockedTypes)
+	a.compiledAllowed = newFileTypeList(a.AllowedTypes)
+	return a.compiledBlocked, a.compiledAllowed
+}
+
+// Returns the lower case extension without the dot, and the mime type guessed from it
+func attachmentType(attachment *discordgo.MessageAttachment) (ext, mimeType string) {
+	ext = strings.ToLower(strings.TrimPrefix(path.Ext(attachment.Filename), "."))
+	if ext == "" {
+		return
+	}
+
+	mimeType = mime.TypeByExtension("." + ext)
+	if i := strings.IndexByte(mimeType, ';'); i != -1 {
+		mimeType = mimeType[:i]
+	}
+	return
+}
+
+func (a *AttachmentRule) Name() string { return "Attachments" }
+
+// Triggers on attachments of blocked types, too large attachments, too many attachments and images (or not images) in channels that don't allow them
+func (a *AttachmentRule) Check(evt *discordgo.Message, channel *discordgo.Channel, client *redis.Client) (del bool, punishment Punishment, msg string, err error) {
+	if len(evt.Attachments) < 1 {
+		return
+	}
+
+	blocked, allowed := a.GetCompiled()
+
+	if a.MaxAttachments > 0 && len(evt.Attachments) > a.MaxAttachments {
+		msg = fmt.Sprintf("Too many attachments (max %d).", a.MaxAttachments)
+	}
+
+	imagesOnly := containsString(a.ImagesOnlyChannels, channel.ID)
+	noImages := containsString(a.NoImagesChannels, channel.ID)
+
+	for _, attachment := range evt.Attachments {
+		if msg != "" {
+			break
+		}
+
+		ext, mimeType := attachmentType(attachment)
+		// Discord sets the dimensions of images
+		isImage := attachment.Width > 0 || strings.HasPrefix(mimeType, "image/")
+
+		switch {
+		case blocked.Matches(ext, mimeType) || (!allowed.Empty() && !allowed.Matches(ext, mimeType)):
+			msg = "That file type is not allowed."
+		case a.MaxFileSizeKB > 0 && attachment.Size > a.MaxFileSizeKB*1024:
+			msg = fmt.Sprintf("That file is too large (max %d KB).", a.MaxFileSizeKB)
+		case imagesOnly && !isImage:
+			msg = "Only images are allowed in this channel."
+		case noImages && isImage:
+			msg = "Images are not allowed in this channel."
+		}
+	}
+
+	if msg == "" {
+		return
+	}
+
+	del = true
+	punishment, err = a.PushViolation(client, KeyViolations(channel.GuildID, evt.Author.ID, "attachment"))
+	return
+}
+
+// NewMemberRule restricts what members who recently joined, or have new accounts, can post
+type NewMemberRule struct {
+	BaseRule `valid:"traverse"`
+
+	// Members who joined less than this many minutes ago are restricted, 0 to disable
+	MemberAgeMinutes int `valid:"0,43200"`
+	// Members with accounts younger than this many days are restricted, 0 to disable
+	AccountAgeDays int `valid:"0,365"`
+
+	BlockLinks       bool
+	BlockInvites     bool
+	BlockAttachments bool
+	BlockMentions    bool
+}
+
+func (n *NewMemberRule) Name() string { return "NewMembers" }
+
+// Check without the member, only the account age is checked
+func (n *NewMemberRule) Check(evt *discordgo.Message, channel *discordgo.Channel, client *redis.Client) (del bool, punishment Punishment, msg string, err error) {
+	return n.CheckMember(evt, nil, channel, client)
+}
+
+// Triggers when a new member posts something they're restricted from posting
+func (n *NewMemberRule) CheckMember(evt *discordgo.Message, member *discordgo.Member, channel *discordgo.Channel, client *redis.Client) (del bool, punishment Punishment, msg string, err error) {
+	if !n.isNew(evt.Author, member) {
+		return
+	}
+
+	switch {
+	case n.BlockLinks && len(messageLinks(evt, false)) > 0:
+		msg = "New members can't post links yet."
+	case n.BlockInvites && inviteRegex.MatchString(evt.ContentWithMentionsReplaced()):
+		msg = "New members can't post server invites yet."
+	case n.BlockAttachments && len(evt.Attachments) > 0:
+		msg = "New members can't post attachments yet."
+	case n.BlockMentions && (len(evt.Mentions) > 0 || len(evt.MentionRoles) > 0 || evt.MentionEveryone):
+		msg = "New members can't mention others yet."
+	default:
+		return
+	}
+
+	del = true
+	punishment, err = n.PushViolation(client, KeyViolations(channel.GuildID, evt.Author.ID, "newmember"))
+	return
+}
+
+// Returns true if the member joined recently or the account is new
+func (n *NewMemberRule) isNew(user *discordgo.User, member *discordgo.Member) bool {
+	if n.AccountAgeDays > 0 && time.Since(common.SnowflakeTime(user.ID)) < time.Duration(n.AccountAgeDays)*time.Hour*24 {
+		return true
+	}
+
+	if n.MemberAgeMinutes > 0 && member != nil {
+		joinedAt, err := discordgo.Timestamp(member.JoinedAt).Parse()
+		if err == nil && time.Since(joinedAt) < time.Duration(n.MemberAgeMinutes)*time.Minute {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,88 @@
+package automod
+
+// These lists are in alphabethical order, subdomains are matched as well
+// Open a pr or bug me on discord if you want a site added
+
+// IP loggers, known phishing sites (mostly fake steam and discord nitro ones) and malware hosts
+var BuiltinBadSites = map[string]bool{
+	"2no.co":                  true,
+	"blasze.com":              true,
+	"blasze.tk":               true,
+	"discord-gift.com":        true,
+	"discord-nitro.com":       true,
+	"discordapp-nitro.com":    true,
+	"discordgift.site":        true,
+	"discordnitro.gift":       true,
+	"free-steam-giveaway.com": true,
+	"gift-discord.com":        true,
+	"grabify.link":            true,
+	"iplis.ru":                true,
+	"iplogger.com":            true,
+	"iplogger.info":           true,
+	"iplogger.org":            true,
+	"iplogger.ru":             true,
+	"ps3cfw.com":              true,
+	"steamcommumity.com":      true,
+	"steamcommunitly.com":     true,
+	"steamcommunlty.com":      true,
+	"steamcommunnity.com":     true,
+	"steamcomrnunity.com":     true,
+	"steampowered.ru":         true,
+	"stearncommunity.com":     true,
+	"stearnpowered.com":       true,
+	"yip.su":                  true,
+}
+
+var BuiltinPornSites = map[string]bool{
+	"beeg.com":        true,
+	"brazzers.com":    true,
+	"chaturbate.com":  true,
+	"e-hentai.org":    true,
+	"exhentai.org":    true,
+	"fakku.net":       true,
+	"gelbooru.com":    true,
+	"hentaihaven.org": true,
+	"nhentai.net":     true,
+	"porn.com":        true,
+	"pornhub.com":     true,
+	"redtube.com":     true,
+	"rule34.xxx":      true,
+	"spankbang.com":   true,
+	"tube8.com":       true,
+	"xhamster.com":    true,
+	"xnxx.com":        true,
+	"xvideos.com":     true,
+	"youjizz.com":     true,
+	"youporn.com":     true,
+}
+
+// URL shorteners, links to these are followed to check where they lead
+var BuiltinShorteners = map[string]bool{
+	"adf.ly":      true,
+	"bit.do":      true,
+	"bit.ly":      true,
+	"buff.ly":     true,
+	"cutt.ly":     true,
+	"goo.gl":      true,
+	"is.gd":       true,
+	"ow.ly":       true,
+	"rb.gy":       true,
+	"rebrand.ly":  true,
+	"shorturl.at": true,
+	"t.co":        true,
+	"tiny.cc":     true,
+	"tinyurl.com": true,
+	"v.gd":        true,
+}
+
+// Commonly impersonated sites, domains made to look like these (but aren't) are treated as bad sites
+var BuiltinLookalikeTargets = map[string]bool{
+	"discord.com":        true,
+	"discord.gg":         true,
+	"discord.gift":       true,
+	"discordapp.com":     true,
+	"paypal.com":         true,
+	"steamcommunity.com": true,
+	"steampowered.com":   true,
+	"twitch.tv":          true,
+}
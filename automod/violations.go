@@ -0,0 +1,200 @@
+package automod
+
+// The violation history, every triggered rule is stored here for the stats page and the violations command
+
+import (
+	"github.com/Sirupsen/logrus"
+	"github.com/jinzhu/gorm"
+	"github.com/jonas747/discordgo"
+	"github.com/jonas747/yagpdb/common"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// Violations older than this are removed
+	ViolationRetentionDays = 30
+	// Max length of the stored message excerpt
+	ViolationExcerptLength = 200
+)
+
+type Violation struct {
+	common.SmallModel
+
+	GuildID   int64 `gorm:"index"`
+	UserID    int64 `gorm:"index"`
+	ChannelID int64
+
+	Username string
+	// Name of the rule that was triggered
+	Rule    string `gorm:"index"`
+	Reason  string
+	Content string
+	// The action taken for the message as a whole, since multiple rules can trigger on the same one
+	Action string
+
+	// Marked as a false positive by an admin, these are excluded from the stats
+	FalsePositive bool
+}
+
+func (v *Violation) TableName() string {
+	return "automod_violations"
+}
+
+// Returns the human readable name of the rule
+func (v *Violation) RuleName() string {
+	return RuleDisplayName(v.Rule)
+}
+
+// Returns the excerpt of the message stored with violations
+func violationExcerpt(content string) string {
+	if utf8.RuneCountInString(content) <= ViolationExcerptLength {
+		return content
+	}
+
+	runes := []rune(content)
+	return string(runes[:ViolationExcerptLength-3]) + "..."
+}
+
+// StoreViolations stores a violation for each of the rules triggered by the message
+func StoreViolations(guildID string, channel *discordgo.Channel, user *discordgo.User, m *discordgo.Message, triggered []*triggeredRule, action string) error {
+	for _, t := range triggered {
+		violation := &Violation{
+			GuildID:   common.MustParseInt(guildID),
+			UserID:    common.MustParseInt(user.ID),
+			ChannelID: common.MustParseInt(channel.ID),
+			Username:  user.Username + "#" + user.Discriminator,
+			Rule:      t.Name,
+			Reason:    t.Msg,
+			Content:   violationExcerpt(m.Content),
+			Action:    action,
+		}
+
+		err := common.SQL.Create(violation).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func violationsSince() time.Time {
+	return time.Now().Add(-time.Hour * 24 * ViolationRetentionDays)
+}
+
+// GetViolations returns the most recent violations in the guild, of a single user if userID is not 0
+func GetViolations(guildID, userID int64, limit, offset int) ([]*Violation, error) {
+	q := common.SQL.Where("guild_id = ?", guildID)
+	if userID != 0 {
+		q = q.Where("user_id = ?", userID)
+	}
+
+	var result []*Violation
+	err := q.Order("id desc").Limit(limit).Offset(offset).Find(&result).Error
+	if err == gorm.ErrRecordNotFound {
+		err = nil
+	}
+	return result, err
+}
+
+// SetViolationFalsePositive marks or unmarks a violation as a false positive, returns false if it didn't exist
+func SetViolationFalsePositive(guildID int64, id int, falsePositive bool) (bool, error) {
+	result := common.SQL.Model(&Violation{}).Where("guild_id = ? AND id = ?", guildID, id).Update("false_positive", falsePositive)
+	return result.RowsAffected > 0, result.Error
+}
+
+type ViolationOffender struct {
+	UserID     int64
+	Username   string
+	Violations int
+}
+
+// TopOffenders returns the users with the most violations in the retention period, excluding false positives
+func TopOffenders(guildID int64, limit int) ([]*ViolationOffender, error) {
+	rows, err := common.SQL.Raw(`SELECT user_id, max(username), count(*) AS num FROM automod_violations
+		WHERE guild_id = ? AND created_at > ? AND false_positive = false
+		GROUP BY user_id ORDER BY num DESC LIMIT ?`, guildID, violationsSince(), limit).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]*ViolationOffender, 0, limit)
+	for rows.Next() {
+		offender := &ViolationOffender{}
+		err = rows.Scan(&offender.UserID, &offender.Username, &offender.Violations)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, offender)
+	}
+
+	return result, rows.Err()
+}
+
+// RuleDayStats is the number of times each rule triggered on each day
+type RuleDayStats struct {
+	// Days with any violations, newest first in the form 2006-01-02
+	Days []string
+	// Rules with any violations
+	Rules []string
+	// Counts[day][rule]
+	Counts map[string]map[string]int
+	// Total violations per rule
+	Totals map[string]int
+}
+
+// TriggersPerRulePerDay returns the number of violations of each rule per day in the retention period, excluding false positives
+func TriggersPerRulePerDay(guildID int64) (*RuleDayStats, error) {
+	rows, err := common.SQL.Raw(`SELECT to_char(date_trunc('day', created_at), 'YYYY-MM-DD') AS day, rule, count(*) FROM automod_violations
+		WHERE guild_id = ? AND created_at > ? AND false_positive = false
+		GROUP BY day, rule ORDER BY day DESC`, guildID, violationsSince()).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := &RuleDayStats{
+		Counts: make(map[string]map[string]int),
+		Totals: make(map[string]int),
+	}
+
+	for rows.Next() {
+		var day, rule string
+		var count int
+		err = rows.Scan(&day, &rule, &count)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := stats.Counts[day]; !ok {
+			stats.Counts[day] = make(map[string]int)
+			stats.Days = append(stats.Days, day)
+		}
+		stats.Counts[day][rule] = count
+		stats.Totals[rule] += count
+	}
+
+	// Keep the order of the rules the same as on the settings page, with the custom rules last
+	for _, r := range append(NewConfig().Rules(), &CustomRule{}) {
+		if stats.Totals[r.Name()] > 0 {
+			stats.Rules = append(stats.Rules, r.Name())
+		}
+	}
+
+	return stats, rows.Err()
+}
+
+// Removes violations older than the retention period every hour
+func runViolationCleaner() {
+	ticker := time.NewTicker(time.Hour)
+	for {
+		err := common.SQL.Where("created_at < ?", violationsSince()).Delete(Violation{}).Error
+		if err != nil {
+			logrus.WithError(err).Error("Failed removing old automod violations")
+		}
+
+		<-ticker.C
+	}
+}
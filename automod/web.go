@@ -3,6 +3,7 @@ package automod
 import (
 	log "github.com/Sirupsen/logrus"
 	"github.com/jonas747/discordgo"
+	"github.com/jonas747/yagpdb/common"
 	"github.com/jonas747/yagpdb/common/pubsub"
 	"github.com/jonas747/yagpdb/web"
 	"goji.io"
@@ -10,6 +11,7 @@ import (
 	"golang.org/x/net/context"
 	"html/template"
 	"net/http"
+	"strconv"
 )
 
 type CtxKey int
@@ -23,7 +25,7 @@ type GeneralForm struct {
 }
 
 func (p *Plugin) InitWeb() {
-	web.Templates = template.Must(web.Templates.ParseFiles("templates/plugins/automod.html"))
+	web.Templates = template.Must(web.Templates.ParseFiles("templates/plugins/automod.html", "templates/plugins/automod_stats.html", "templates/plugins/automod_custom_rules.html", "templates/plugins/automod_overrides.html"))
 
 	autmodMux := goji.SubMux()
 	web.CPMux.HandleC(pat.New("/automod/*"), autmodMux)
@@ -40,6 +42,28 @@ func (p *Plugin) InitWeb() {
 	autmodMux.HandleC(pat.Get("/"), getHandler)
 	autmodMux.HandleC(pat.Get(""), getHandler)
 
+	customRulesHandler := web.ControllerHandler(HandleCustomRules, "cp_automod_custom_rules")
+	autmodMux.HandleC(pat.Get("/customrules"), customRulesHandler)
+	autmodMux.HandleC(pat.Get("/customrules/"), customRulesHandler)
+	autmodMux.HandleC(pat.Post("/customrules"), web.ControllerPostHandler(HandleNewCustomRule, customRulesHandler, CustomRule{}, "Created a custom automod rule"))
+	autmodMux.HandleC(pat.Post("/customrules/:rule/update"), web.ControllerPostHandler(HandleUpdateCustomRule, customRulesHandler, CustomRule{}, "Updated a custom automod rule"))
+	autmodMux.HandleC(pat.Post("/customrules/:rule/delete"), web.ControllerHandler(HandleDeleteCustomRule, "cp_automod_custom_rules"))
+
+	overridesHandler := web.ControllerHandler(HandleChannelOverrides, "cp_automod_overrides")
+	autmodMux.HandleC(pat.Get("/overrides"), overridesHandler)
+	autmodMux.HandleC(pat.Get("/overrides/"), overridesHandler)
+	autmodMux.HandleC(pat.Post("/overrides"), web.ControllerPostHandler(HandleNewChannelOverride, overridesHandler, NewChannelOverrideForm{}, "Added automod channel overrides"))
+
+	overrideHandler := web.ControllerHandler(HandleChannelOverride, "cp_automod_override")
+	autmodMux.HandleC(pat.Get("/overrides/:channel"), overrideHandler)
+	autmodMux.HandleC(pat.Post("/overrides/:channel"), web.ControllerPostHandler(HandleUpdateChannelOverride, overrideHandler, Config{}, "Updated automod channel overrides"))
+	autmodMux.HandleC(pat.Post("/overrides/:channel/delete"), web.ControllerHandler(HandleDeleteChannelOverride, "cp_automod_overrides"))
+
+	statsHandler := web.ControllerHandler(HandleStats, "cp_automod_stats")
+	autmodMux.HandleC(pat.Get("/stats"), statsHandler)
+	autmodMux.HandleC(pat.Get("/stats/"), statsHandler)
+	autmodMux.HandleC(pat.Post("/stats/:violation/falsepositive"), web.ControllerHandler(HandleMarkFalsePositive, "cp_automod_stats"))
+
 	// Post handlers
 	autmodMux.HandleC(pat.Post("/"), ExtraPostMW(web.SimpleConfigSaverHandler(Config{}, getHandler)))
 	autmodMux.HandleC(pat.Post(""), ExtraPostMW(web.SimpleConfigSaverHandler(Config{}, getHandler)))
@@ -66,3 +90,297 @@ func ExtraPostMW(inner goji.Handler) goji.Handler {
 	}
 	return goji.HandlerFunc(mw)
 }
+
+func HandleCustomRules(ctx context.Context, w http.ResponseWriter, r *http.Request) (web.TemplateData, error) {
+	client, activeGuild, templateData := web.GetBaseCPContextData(ctx)
+	templateData["VisibleURL"] = "/cp/" + activeGuild.ID + "/automod/customrules/"
+
+	rules, _, err := GetCustomRules(client, activeGuild.ID)
+	if err != nil {
+		return templateData, err
+	}
+
+	templateData["CustomRules"] = rules
+	templateData["NewCustomRule"] = &CustomRule{Enabled: true, Delete: true}
+	templateData["MaxCustomRules"] = MaxCustomRules
+	return templateData, nil
+}
+
+func HandleNewCustomRule(ctx context.Context, w http.ResponseWriter, r *http.Request) (web.TemplateData, error) {
+	client, activeGuild, templateData := web.GetBaseCPContextData(ctx)
+
+	rule := ctx.Value(common.ContextKeyParsedForm).(*CustomRule)
+
+	current, highest, err := GetCustomRules(client, activeGuild.ID)
+	if err != nil {
+		return templateData, err
+	}
+
+	if len(current) >= MaxCustomRules {
+		return templateData, web.NewPublicError("Max ", MaxCustomRules, " custom rules allowed")
+	}
+
+	rule.ID = highest + 1
+	err = rule.Save(client, activeGuild.ID)
+	if err != nil {
+		return templateData, err
+	}
+
+	pubsub.Publish(client, "update_automod_rules", activeGuild.ID, nil)
+	return templateData, nil
+}
+
+func HandleUpdateCustomRule(ctx context.Context, w http.ResponseWriter, r *http.Request) (web.TemplateData, error) {
+	client, activeGuild, templateData := web.GetBaseCPContextData(ctx)
+
+	rule := ctx.Value(common.ContextKeyParsedForm).(*CustomRule)
+
+	id, err := strconv.Atoi(pat.Param(ctx, "rule"))
+	if err != nil {
+		return templateData, web.NewPublicError("Invalid rule")
+	}
+
+	exists, _ := client.Cmd("HEXISTS", KeyCustomRules(activeGuild.ID), id).Bool()
+	if !exists {
+		return templateData, web.NewPublicError("That rule dosen't exist?")
+	}
+
+	rule.ID = id
+	err = rule.Save(client, activeGuild.ID)
+	if err != nil {
+		return templateData, err
+	}
+
+	pubsub.Publish(client, "update_automod_rules", activeGuild.ID, nil)
+	return templateData, nil
+}
+
+func HandleDeleteCustomRule(ctx context.Context, w http.ResponseWriter, r *http.Request) (web.TemplateData, error) {
+	client, activeGuild, templateData := web.GetBaseCPContextData(ctx)
+
+	err := client.Cmd("HDEL", KeyCustomRules(activeGuild.ID), pat.Param(ctx, "rule")).Err
+	if err != nil {
+		return templateData, err
+	}
+
+	pubsub.Publish(client, "update_automod_rules", activeGuild.ID, nil)
+
+	user := ctx.Value(common.ContextKeyUser).(*discordgo.User)
+	go common.AddCPLogEntry(user, activeGuild.ID, "Deleted custom automod rule #"+pat.Param(ctx, "rule"))
+
+	return HandleCustomRules(ctx, w, r)
+}
+
+type NewChannelOverrideForm struct {
+	Channel string `valid:"channel,false"`
+}
+
+// Lists the channels with overrides
+func HandleChannelOverrides(ctx context.Context, w http.ResponseWriter, r *http.Request) (web.TemplateData, error) {
+	client, activeGuild, templateData := web.GetBaseCPContextData(ctx)
+	templateData["VisibleURL"] = "/cp/" + activeGuild.ID + "/automod/overrides/"
+
+	overrides, err := GetChannelOverrides(client, activeGuild.ID)
+	if err != nil {
+		return templateData, err
+	}
+
+	templateData["ChannelOverrides"] = overrides
+	templateData["RuleNames"] = RuleDisplayNames
+	return templateData, nil
+}
+
+// Adds overrides to a channel, starting out with the server wide settings and no overridden rules
+func HandleNewChannelOverride(ctx context.Context, w http.ResponseWriter, r *http.Request) (web.TemplateData, error) {
+	client, activeGuild, templateData := web.GetBaseCPContextData(ctx)
+
+	form := ctx.Value(common.ContextKeyParsedForm).(*NewChannelOverrideForm)
+
+	exists, _ := client.Cmd("HEXISTS", KeyChannelOverrides(activeGuild.ID), form.Channel).Bool()
+	if exists {
+		return templateData, web.NewPublicError("That channel already has overrides")
+	}
+
+	config, err := GetConfig(client, activeGuild.ID)
+	if err != nil {
+		return templateData, err
+	}
+
+	override := &ChannelOverride{
+		ChannelID: form.Channel,
+		Rules:     []string{},
+		Config:    config,
+	}
+
+	err = override.Save(client, activeGuild.ID)
+	return templateData, err
+}
+
+type overrideRuleOption struct {
+	Name        string
+	DisplayName string
+	Overridden  bool
+}
+
+// Shows the rule settings of a channel override, using the same tabs as the main settings page
+func HandleChannelOverride(ctx context.Context, w http.ResponseWriter, r *http.Request) (web.TemplateData, error) {
+	client, activeGuild, templateData := web.GetBaseCPContextData(ctx)
+	channelID := pat.Param(ctx, "channel")
+	templateData["VisibleURL"] = "/cp/" + activeGuild.ID + "/automod/overrides/" + channelID
+
+	overrides, err := GetChannelOverrides(client, activeGuild.ID)
+	if err != nil {
+		return templateData, err
+	}
+
+	override, ok := overrides[channelID]
+	if !ok {
+		return templateData, web.NewPublicError("That channel dosen't have any overrides?")
+	}
+
+	options := make([]*overrideRuleOption, 0)
+	for _, rule := range override.Config.Rules() {
+		options = append(options, &overrideRuleOption{
+			Name:        rule.Name(),
+			DisplayName: RuleDisplayName(rule.Name()),
+			Overridden:  containsString(override.Rules, rule.Name()),
+		})
+	}
+
+	templateData["AutomodConfig"] = override.Config
+	templateData["OverrideChannel"] = channelID
+	templateData["OverrideRules"] = options
+	return templateData, nil
+}
+
+// Saves the settings of a channel override, the overridden rules are the checked "OverrideRules" form values
+func HandleUpdateChannelOverride(ctx context.Context, w http.ResponseWriter, r *http.Request) (web.TemplateData, error) {
+	client, activeGuild, templateData := web.GetBaseCPContextData(ctx)
+	channelID := pat.Param(ctx, "channel")
+
+	config := ctx.Value(common.ContextKeyParsedForm).(*Config)
+
+	exists, _ := client.Cmd("HEXISTS", KeyChannelOverrides(activeGuild.ID), channelID).Bool()
+	if !exists {
+		return templateData, web.NewPublicError("That channel dosen't have any overrides?")
+	}
+
+	rules := make([]string, 0)
+	for _, rule := range NewConfig().Rules() {
+		if containsString(r.Form["OverrideRules"], rule.Name()) {
+			rules = append(rules, rule.Name())
+		}
+	}
+
+	override := &ChannelOverride{
+		ChannelID: channelID,
+		Rules:     rules,
+		Config:    config,
+	}
+
+	err := override.Save(client, activeGuild.ID)
+	if err != nil {
+		return templateData, err
+	}
+
+	pubsub.Publish(client, "update_automod_rules", activeGuild.ID, nil)
+	return templateData, nil
+}
+
+func HandleDeleteChannelOverride(ctx context.Context, w http.ResponseWriter, r *http.Request) (web.TemplateData, error) {
+	client, activeGuild, templateData := web.GetBaseCPContextData(ctx)
+
+	err := client.Cmd("HDEL", KeyChannelOverrides(activeGuild.ID), pat.Param(ctx, "channel")).Err
+	if err != nil {
+		return templateData, err
+	}
+
+	pubsub.Publish(client, "update_automod_rules", activeGuild.ID, nil)
+
+	user := ctx.Value(common.ContextKeyUser).(*discordgo.User)
+	go common.AddCPLogEntry(user, activeGuild.ID, "Removed automod overrides of channel "+pat.Param(ctx, "channel"))
+
+	return HandleChannelOverrides(ctx, w, r)
+}
+
+const violationsPerPage = 50
+
+// Shows the top offenders, triggers per rule per day and the recent violations, optionally filtered by ?user=
+func HandleStats(ctx context.Context, w http.ResponseWriter, r *http.Request) (web.TemplateData, error) {
+	_, activeGuild, templateData := web.GetBaseCPContextData(ctx)
+	templateData["VisibleURL"] = "/cp/" + activeGuild.ID + "/automod/stats/"
+
+	guildID := common.MustParseInt(activeGuild.ID)
+
+	userStr := r.URL.Query().Get("user")
+	userID, _ := strconv.ParseInt(userStr, 10, 64)
+
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 0 {
+		page = 0
+	}
+
+	offenders, err := TopOffenders(guildID, 10)
+	if err != nil {
+		return templateData, err
+	}
+
+	perDay, err := TriggersPerRulePerDay(guildID)
+	if err != nil {
+		return templateData, err
+	}
+
+	violations, err := GetViolations(guildID, userID, violationsPerPage, page*violationsPerPage)
+	if err != nil {
+		return templateData, err
+	}
+
+	ruleNames := make(map[string]string)
+	for _, rule := range perDay.Rules {
+		ruleNames[rule] = RuleDisplayName(rule)
+	}
+
+	templateData["TopOffenders"] = offenders
+	templateData["PerDay"] = perDay
+	templateData["RuleNames"] = ruleNames
+	templateData["Violations"] = violations
+	templateData["RetentionDays"] = ViolationRetentionDays
+	if userID != 0 {
+		templateData["FilterUser"] = userStr
+	}
+	templateData["Page"] = page
+	templateData["PrevPage"] = page - 1
+	templateData["NextPage"] = page + 1
+	templateData["HasNextPage"] = len(violations) >= violationsPerPage
+
+	return templateData, nil
+}
+
+// Marks a violation as a false positive, or unmarks it if the form value "undo" is set
+func HandleMarkFalsePositive(ctx context.Context, w http.ResponseWriter, r *http.Request) (web.TemplateData, error) {
+	_, activeGuild, templateData := web.GetBaseCPContextData(ctx)
+
+	id, err := strconv.Atoi(pat.Param(ctx, "violation"))
+	if err != nil {
+		return templateData, web.NewPublicError("Invalid violation")
+	}
+
+	falsePositive := r.FormValue("undo") == ""
+	found, err := SetViolationFalsePositive(common.MustParseInt(activeGuild.ID), id, falsePositive)
+	if err != nil {
+		return templateData, err
+	}
+	if !found {
+		return templateData, web.NewPublicError("Violation not found")
+	}
+
+	msg := "Marked automod violation #" + pat.Param(ctx, "violation") + " as a false positive"
+	if !falsePositive {
+		msg = "Unmarked automod violation #" + pat.Param(ctx, "violation") + " as a false positive"
+	}
+
+	user := ctx.Value(common.ContextKeyUser).(*discordgo.User)
+	go common.AddCPLogEntry(user, activeGuild.ID, msg)
+
+	return HandleStats(ctx, w, r)
+}
@@ -0,0 +1,260 @@
+package automod
+
+// The word filter, matches words, wildcards, phrases and regexes against a normalized version of messages
+// to catch the common ways of getting around it like "b a d", "b4d", "baaaad" and lookalike unicode characters
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Characters that look like or are used in place of latin letters
+var homoglyphs = map[rune]rune{
+	// Cyrillic
+	'а': 'a', 'в': 'b', 'е': 'e', 'ё': 'e', 'к': 'k', 'м': 'm', 'н': 'h', 'о': 'o', 'р': 'p', 'с': 'c',
+	'т': 't', 'у': 'y', 'х': 'x', 'і': 'i', 'ї': 'i', 'ј': 'j', 'ѕ': 's', 'ԁ': 'd', 'ԛ': 'q', 'ԝ': 'w',
+	// Greek
+	'α': 'a', 'β': 'b', 'ε': 'e', 'η': 'n', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o', 'ρ': 'p', 'τ': 't',
+	'υ': 'u', 'χ': 'x', 'ω': 'w',
+	// Latin with diacritics
+	'à': 'a', 'á': 'a', 'â': 'a', 'ã': 'a', 'ä': 'a', 'å': 'a', 'ā': 'a', 'ç': 'c', 'è': 'e', 'é': 'e',
+	'ê': 'e', 'ë': 'e', 'ē': 'e', 'ì': 'i', 'í': 'i', 'î': 'i', 'ï': 'i', 'ı': 'i', 'ñ': 'n', 'ò': 'o',
+	'ó': 'o', 'ô': 'o', 'õ': 'o', 'ö': 'o', 'ø': 'o', 'ù': 'u', 'ú': 'u', 'û': 'u', 'ü': 'u', 'ý': 'y',
+	'ÿ': 'y', 'ß': 's', 'ɡ': 'g',
+	// Leetspeak
+	'0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's', '7': 't', '8': 'b', '@': 'a', '$': 's',
+	'|': 'l', '€': 'e',
+}
+
+// Returns true for invisible characters used to split up words
+func isZeroWidth(r rune) bool {
+	switch r {
+	case 0x200B, 0x200C, 0x200D, 0x2060, 0xFEFF, 0x00AD:
+		return true
+	}
+	return false
+}
+
+// normalizeText lower cases s, removes invisible and combining characters and maps lookalike characters and leetspeak to latin letters
+// Anything else that isn't a letter is turned into a space, except * if keepWildcards is set
+func normalizeText(s string, keepWildcards bool) string {
+	return strings.Map(func(r rune) rune {
+		if isZeroWidth(r) || unicode.In(r, unicode.Mn, unicode.Me) {
+			return -1
+		}
+
+		// Fullwidth forms
+		if r >= 0xFF01 && r <= 0xFF5E {
+			r -= 0xFEE0
+		}
+
+		r = unicode.ToLower(r)
+		if mapped, ok := homoglyphs[r]; ok {
+			return mapped
+		}
+
+		if r == '*' && keepWildcards {
+			return r
+		}
+
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return ' '
+	}, s)
+}
+
+// Returns the words in the normalized text, with runs of single letters also joined into a word ("b a d" -> "bad")
+func normalizedWords(normalized string) []string {
+	fields := strings.Fields(normalized)
+	words := fields
+
+	joined := ""
+	for i := 0; i <= len(fields); i++ {
+		if i < len(fields) && utf8.RuneCountInString(fields[i]) == 1 {
+			joined += fields[i]
+			continue
+		}
+
+		if utf8.RuneCountInString(joined) > 1 {
+			words = append(words, joined)
+		}
+		joined = ""
+	}
+
+	return words
+}
+
+// A sequence of the same letter, "aaa" is {'a', 3}
+type letterRun struct {
+	letter rune
+	count  int
+}
+
+func letterRuns(s string) []letterRun {
+	var runs []letterRun
+	for _, r := range s {
+		if len(runs) > 0 && runs[len(runs)-1].letter == r {
+			runs[len(runs)-1].count++
+			continue
+		}
+		runs = append(runs, letterRun{letter: r, count: 1})
+	}
+	return runs
+}
+
+// Collapses repeated letters, "baaaad" -> "bad"
+func collapseRepeats(s string) string {
+	runs := letterRuns(s)
+	out := make([]rune, len(runs))
+	for i, r := range runs {
+		out[i] = r.letter
+	}
+	return string(out)
+}
+
+// Returns true if word is the banned word with some of the letters repeated, "baaad" matches "bad" but "as" dosen't match "ass"
+func matchesRepeated(word, banned string) bool {
+	wordRuns := letterRuns(word)
+	bannedRuns := letterRuns(banned)
+	if len(wordRuns) != len(bannedRuns) {
+		return false
+	}
+
+	for i, r := range bannedRuns {
+		if wordRuns[i].letter != r.letter || wordRuns[i].count < r.count {
+			return false
+		}
+	}
+	return true
+}
+
+// Compiles a normalized wildcard or phrase entry into a regex matched against the normalized words joined by spaces
+// Each letter may be repeated, * matches any part of a word
+func compileWordPattern(entry string) (*regexp.Regexp, error) {
+	pattern := ""
+	for _, run := range letterRuns(entry) {
+		switch run.letter {
+		case '*':
+			pattern += `\S*`
+		case ' ':
+			pattern += " "
+		default:
+			pattern += strings.Repeat(regexp.QuoteMeta(string(run.letter)), run.count) + "+"
+		}
+	}
+
+	return regexp.Compile(`(?:^| )` + pattern + `(?: |$)`)
+}
+
+// WordFilter is a compiled list of banned words, phrases and regexes
+type WordFilter struct {
+	// Plain words by their collapsed form, to avoid going through all of them for every word
+	words map[string][]string
+	// Wildcards and phrases
+	patterns []*regexp.Regexp
+	// User regexes, matched against both the original and the normalized message
+	regexes []*regexp.Regexp
+}
+
+// NewWordFilter compiles the word filter, invalid entries are skipped
+// words are whitespace separated, phrases and regexes are one per line
+func NewWordFilter(words []string, phrases []string, regexes []string) *WordFilter {
+	f := &WordFilter{
+		words: make(map[string][]string),
+	}
+
+	entries := make([]string, 0, len(words)+len(phrases))
+	entries = append(entries, words...)
+	entries = append(entries, phrases...)
+
+	for _, entry := range entries {
+		normalized := strings.Join(strings.Fields(normalizeText(entry, true)), " ")
+		if normalized == "" {
+			continue
+		}
+
+		if !strings.ContainsAny(normalized, "* ") {
+			collapsed := collapseRepeats(normalized)
+			f.words[collapsed] = append(f.words[collapsed], normalized)
+			continue
+		}
+
+		compiled, err := compileWordPattern(normalized)
+		if err == nil {
+			f.patterns = append(f.patterns, compiled)
+		}
+	}
+
+	for _, entry := range regexes {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		compiled, err := regexp.Compile("(?i)" + entry)
+		if err == nil {
+			f.regexes = append(f.regexes, compiled)
+		}
+	}
+
+	return f
+}
+
+// Match returns true if the message contains anything from the filter
+func (f *WordFilter) Match(content string) bool {
+	normalized := normalizeText(content, false)
+	words := normalizedWords(normalized)
+
+	if len(f.words) > 0 {
+		for _, w := range words {
+			candidates, ok := f.words[collapseRepeats(w)]
+			if !ok {
+				continue
+			}
+
+			for _, banned := range candidates {
+				if matchesRepeated(w, banned) {
+					return true
+				}
+			}
+		}
+	}
+
+	if len(f.patterns) > 0 {
+		joined := strings.Join(words, " ")
+		for _, p := range f.patterns {
+			if p.MatchString(joined) {
+				return true
+			}
+		}
+	}
+
+	for _, r := range f.regexes {
+		if r.MatchString(content) || r.MatchString(normalized) {
+			return true
+		}
+	}
+
+	return false
+}
+
+var (
+	builtinSwearFilter     *WordFilter
+	builtinSwearFilterOnce sync.Once
+)
+
+// Returns the compiled filter of BuiltinSwearWords, shared between all servers
+func BuiltinSwearFilter() *WordFilter {
+	builtinSwearFilterOnce.Do(func() {
+		words := make([]string, 0, len(BuiltinSwearWords))
+		for w := range BuiltinSwearWords {
+			words = append(words, w)
+		}
+		builtinSwearFilter = NewWordFilter(words, nil, nil)
+	})
+	return builtinSwearFilter
+}
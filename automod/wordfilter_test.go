@@ -0,0 +1,97 @@
+package automod
+
+import (
+	"testing"
+)
+
+func TestNormalizeText(t *testing.T) {
+	cases := []struct {
+		str           string
+		keepWildcards bool
+		expected      string
+	}{
+		{"Hello World", false, "hello world"},
+		{"b4d w0rd$", false, "bad words"},
+		{"b.a.d", false, "b a d"},
+		{"b\u200bad", false, "bad"},
+		{"bäd", false, "bad"},
+		// Combining accent
+		{"be\u0301d", false, "bed"},
+		// Cyrillic а and о
+		{"b\u0430d w\u043erd", false, "bad word"},
+		// Fullwidth
+		{"\uff42\uff41\uff44", false, "bad"},
+		{"ba*", false, "ba "},
+		{"ba*", true, "ba*"},
+	}
+
+	for _, c := range cases {
+		if got := normalizeText(c.str, c.keepWildcards); got != c.expected {
+			t.Errorf("normalizeText(%q, %t) = %q, expected %q", c.str, c.keepWildcards, got, c.expected)
+		}
+	}
+}
+
+func TestCompileWordPattern(t *testing.T) {
+	cases := []struct {
+		entry    string
+		str      string
+		expected bool
+	}{
+		{"bad*", "bad", true},
+		{"bad*", "so badly", true},
+		{"bad*", "notbad", false},
+		{"*bad", "notbad at all", true},
+		{"*bad*", "notbadly", true},
+		{"bad word", "a bad word here", true},
+		{"bad word", "a baaad wooord", true},
+		{"bad word", "a bad sword", false},
+		{"bad word", "bad words", false},
+		// Letters may only be repeated, not left out
+		{"good word", "god word", false},
+		{"good word", "goood word", true},
+	}
+
+	for _, c := range cases {
+		compiled, err := compileWordPattern(c.entry)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", c.entry, err)
+			continue
+		}
+
+		if got := compiled.MatchString(c.str); got != c.expected {
+			t.Errorf("%q matching %q = %t, expected %t", c.entry, c.str, got, c.expected)
+		}
+	}
+}
+
+func TestWordFilterMatch(t *testing.T) {
+	filter := NewWordFilter([]string{"bad", "ass", "wor*"}, []string{"very bad thing"}, []string{`f[o0]+`})
+
+	cases := []struct {
+		str      string
+		expected bool
+	}{
+		{"this is bad", true},
+		{"this is b a d", true},
+		{"this is baaaad", true},
+		{"this is B4D", true},
+		{"this is b\u200bad", true},
+		{"this is b\u0430d", true},
+		{"this is fine", false},
+		{"as you wish", false},
+		{"badger", false},
+		{"a worm", true},
+		{"a sword", false},
+		{"such a very bad thing", true},
+		{"a very good thing", false},
+		{"foo", true},
+		{"f00", true},
+	}
+
+	for _, c := range cases {
+		if got := filter.Match(c.str); got != c.expected {
+			t.Errorf("Match(%q) = %t, expected %t", c.str, got, c.expected)
+		}
+	}
+}
@@ -453,6 +453,26 @@ func CustomMessageDelete(inner func(s *discordgo.Session, evt *discordgo.Message
 	}
 }
 
+func CustomMessageReactionAdd(inner func(s *discordgo.Session, evt *discordgo.MessageReactionAdd, r *redis.Client)) func(s *discordgo.Session, evt *discordgo.MessageReactionAdd) {
+	return func(s *discordgo.Session, evt *discordgo.MessageReactionAdd) {
+		r, err := common.RedisPool.Get()
+		if err != nil {
+			log.WithError(err).WithField("evt", "MessageReactionAdd").Error("Failed retrieving redis client")
+			return
+		}
+
+		defer func() {
+			if err := recover(); err != nil {
+				stack := string(debug.Stack())
+				log.WithField(log.ErrorKey, err).WithField("evt", "MessageReactionAdd").Error("Recovered from panic\n" + stack)
+			}
+			common.RedisPool.Put(r)
+		}()
+
+		inner(s, evt, r)
+	}
+}
+
 func CustomPresenceUpdate(inner func(s *discordgo.Session, evt *discordgo.PresenceUpdate, r *redis.Client)) func(s *discordgo.Session, evt *discordgo.PresenceUpdate) {
 	return func(s *discordgo.Session, evt *discordgo.PresenceUpdate) {
 		r, err := common.RedisPool.Get()
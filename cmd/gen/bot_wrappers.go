@@ -70,6 +70,7 @@ var Events = []string{
 	"MessageCreate",
 	"MessageUpdate",
 	"MessageDelete",
+	"MessageReactionAdd",
 	"PresenceUpdate",
 	"PresencesReplace",
 	"Ready",
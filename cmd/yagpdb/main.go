@@ -2,6 +2,7 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	log "github.com/Sirupsen/logrus"
 	"github.com/fzzy/radix/redis"
 	"github.com/jonas747/yagpdb/automod"
@@ -53,7 +54,7 @@ func init() {
 	flag.BoolVar(&flagDryRun, "dry", false, "Do a dryrun, initialize all plugins but don't actually start anything")
 
 	flag.BoolVar(&flagLogTimestamp, "ts", false, "Set to include timestamps in log")
-	flag.StringVar(&flagAction, "a", "", "Run a action and exit, available actions: connected")
+	flag.StringVar(&flagAction, "a", "", "Run a action and exit, available actions: connected, templatedocs")
 }
 
 func main() {
@@ -108,6 +109,12 @@ func main() {
 	// Setup plugins for bot, but run later if enabled
 	bot.Setup()
 
+	// Documentation of the template functions, after all the plugins have registered theirs
+	if flagAction == "templatedocs" {
+		fmt.Print(common.TemplateFuncsMarkdown())
+		return
+	}
+
 	// RUN FORREST RUN
 	if flagAction != "" {
 		runAction(flagAction)
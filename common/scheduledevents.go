@@ -1,22 +1,87 @@
 package common
 
-// Scheduled events are stored in a redis sorted set, with the score being when they should be triggered in unix time
-// It is checked every minute, so can be up to a minute off.
-// In the key, everythign after : is ignored, use this to store things like, serverid, playerids or other simple
-// data (for example for reminders, you would set it to channelid, and userid)
-
-// LIMITATIONS: different events cannot have same key as another event
+// Scheduled events are stored in redis:
+//  - "scheduled_events_v2" is a sorted set of event ids with the score being when they should be triggered in unix time
+//  - "scheduled_events_v2_data" is a hash of event id -> json encoded ScheduledEvent
+//  - "scheduled_events_v2_processing" is a sorted set of the event ids currently being handled, the score being when
+//    the claim times out. If the process handling them dies they're put back into the queue after that
+//  - "scheduled_events_v2_keys" is a hash of "name:key" -> event id, for events scheduled with a unique key
+//  - "scheduled_events_dead" is a list of events that failed too many times, newest first
+//
+// Due events are checked every second and claimed atomically, so it's safe to run several bot processes.
+// An event may be handled more than once (if the process died before finishing it for example), so handlers should
+// be safe to run again.
+//
+// If the handler returns an error the event is retried later with an exponential backoff, after
+// ScheduledEventMaxRetries retries it's moved to the dead letter list.
 
 import (
+	"encoding/json"
+	"fmt"
 	"github.com/Sirupsen/logrus"
 	"github.com/fzzy/radix/redis"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 )
 
-// If error is not nil, it will be added back
-type ScheduledEvtHandler func(evt string) error
+const (
+	KeyScheduledEvents           = "scheduled_events_v2"
+	KeyScheduledEventsData       = "scheduled_events_v2_data"
+	KeyScheduledEventsProcessing = "scheduled_events_v2_processing"
+	KeyScheduledEventsKeys       = "scheduled_events_v2_keys"
+	KeyScheduledEventsDead       = "scheduled_events_dead"
+	KeyScheduledEventsIDCounter  = "scheduled_events_v2_id"
+
+	// The old sorted set of "name:data" members
+	KeyLegacyScheduledEvents = "scheduled_events"
+)
+
+var (
+	ScheduledEventMaxRetries   = 10
+	ScheduledEventRetryBackoff = time.Second * 10 // Doubled for each retry
+	ScheduledEventMaxBackoff   = time.Hour
+	ScheduledEventClaimTimeout = time.Minute * 5
+	ScheduledEventMaxDead      = 1000
+)
+
+type ScheduledEvent struct {
+	ID        int64           `json:"id"`
+	Name      string          `json:"name"`
+	Key       string          `json:"key,omitempty"`
+	Data      json.RawMessage `json:"data"`
+	Created   int64           `json:"created"`
+	Retries   int             `json:"retries"`
+	LastError string          `json:"last_error,omitempty"`
+
+	// Set on events converted from the old "name:data" format, Data then holds the old data as a json string
+	Legacy bool `json:"legacy,omitempty"`
+}
+
+// LegacyEventData is implemented by event data that can be parsed from the data of the old "name:data" events
+type LegacyEventData interface {
+	ParseLegacy(data string) error
+}
+
+// DecodeData decodes the json data of the event into dst
+func (e *ScheduledEvent) DecodeData(dst interface{}) error {
+	if e.Legacy {
+		if cast, ok := dst.(LegacyEventData); ok {
+			var str string
+			err := json.Unmarshal(e.Data, &str)
+			if err != nil {
+				return err
+			}
+			return cast.ParseLegacy(str)
+		}
+	}
+
+	return json.Unmarshal(e.Data, dst)
+}
+
+// If error is not nil, the event will be retried later
+type ScheduledEvtHandler func(evt *ScheduledEvent) error
 
 var scheduledHandlers = make(map[string]ScheduledEvtHandler)
 
@@ -24,13 +89,147 @@ func RegisterScheduledEventHandler(evt string, handler ScheduledEvtHandler) {
 	scheduledHandlers[evt] = handler
 }
 
-func ScheduleEvent(client *redis.Client, evt, data string, when time.Time) error {
-	reply := client.Cmd("ZADD", "scheduled_events", when.Unix(), evt+":"+data)
-	return reply.Err
+// Moves up to ARGV[3] members with a score lower than ARGV[1] from KEYS[1] to KEYS[2] with ARGV[2] as the new score
+var scriptMoveDue = `
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[3])
+for _, id in ipairs(ids) do
+	redis.call('ZREM', KEYS[1], id)
+	redis.call('ZADD', KEYS[2], ARGV[2], id)
+end
+return ids
+`
+
+// Adds the event, replacing the event with the same unique key (ARGV[4]) if any
+var scriptAddBody = `
+if ARGV[4] ~= '' then
+	local old = redis.call('HGET', KEYS[4], ARGV[4])
+	if old then
+		redis.call('ZREM', KEYS[1], old)
+		redis.call('ZREM', KEYS[3], old)
+		redis.call('HDEL', KEYS[2], old)
+	end
+	redis.call('HSET', KEYS[4], ARGV[4], ARGV[1])
+end
+redis.call('HSET', KEYS[2], ARGV[1], ARGV[3])
+redis.call('ZADD', KEYS[1], ARGV[2], ARGV[1])
+`
+
+var scriptAdd = scriptAddBody + `
+return 1
+`
+
+// Adds the event converted from the legacy member ARGV[5] of KEYS[5] and removes the legacy member,
+// returns 0 without adding it if it was already migrated by another process
+var scriptMigrateLegacy = `
+if not redis.call('ZSCORE', KEYS[5], ARGV[5]) then
+	return 0
+end
+` + scriptAddBody + `
+redis.call('ZREM', KEYS[5], ARGV[5])
+return 1
+`
+
+// Removes the event, ARGV[2] is the unique key if any
+var scriptRemove = `
+redis.call('ZREM', KEYS[1], ARGV[1])
+redis.call('ZREM', KEYS[3], ARGV[1])
+redis.call('HDEL', KEYS[2], ARGV[1])
+if ARGV[2] ~= '' and redis.call('HGET', KEYS[4], ARGV[2]) == ARGV[1] then
+	redis.call('HDEL', KEYS[4], ARGV[2])
+end
+return 1
+`
+
+// Puts a failed event back in the queue, unless it was removed while it was being handled
+var scriptRetry = `
+if redis.call('ZREM', KEYS[3], ARGV[1]) == 0 then
+	return 0
+end
+redis.call('HSET', KEYS[2], ARGV[1], ARGV[3])
+redis.call('ZADD', KEYS[1], ARGV[2], ARGV[1])
+return 1
+`
+
+func evalScheduledScript(client *redis.Client, script string, args ...interface{}) *redis.Reply {
+	cmdArgs := []interface{}{script, 4, KeyScheduledEvents, KeyScheduledEventsData, KeyScheduledEventsProcessing, KeyScheduledEventsKeys}
+	return client.Cmd("EVAL", append(cmdArgs, args...)...)
+}
+
+func uniqueEventKey(name, key string) string {
+	if key == "" {
+		return ""
+	}
+	return name + ":" + key
+}
+
+// ScheduleEvent schedules a new event, data is json encoded and available to the handler through evt.DecodeData
+func ScheduleEvent(client *redis.Client, name string, data interface{}, when time.Time) (int64, error) {
+	return scheduleEvent(client, name, "", data, when)
+}
+
+// ScheduleUniqueEvent schedules an event that replaces any other event with the same name and key
+func ScheduleUniqueEvent(client *redis.Client, name, key string, data interface{}, when time.Time) (int64, error) {
+	return scheduleEvent(client, name, key, data, when)
+}
+
+func scheduleEvent(client *redis.Client, name, key string, data interface{}, when time.Time) (int64, error) {
+	id, serialized, err := newScheduledEvent(client, name, key, data, false)
+	if err != nil {
+		return 0, err
+	}
+
+	err = evalScheduledScript(client, scriptAdd, id, when.Unix(), serialized, uniqueEventKey(name, key)).Err
+	return id, err
+}
+
+// Returns a new event id and the json encoded event
+func newScheduledEvent(client *redis.Client, name, key string, data interface{}, legacy bool) (int64, []byte, error) {
+	encodedData, err := json.Marshal(data)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	id, err := client.Cmd("INCR", KeyScheduledEventsIDCounter).Int64()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	evt := &ScheduledEvent{
+		ID:      id,
+		Name:    name,
+		Key:     key,
+		Data:    encodedData,
+		Created: time.Now().Unix(),
+		Legacy:  legacy,
+	}
+
+	serialized, err := json.Marshal(evt)
+	return id, serialized, err
+}
+
+// RemoveScheduledEvent removes the event by id
+func RemoveScheduledEvent(client *redis.Client, id int64) error {
+	return evalScheduledScript(client, scriptRemove, id, "").Err
 }
 
-func RemoveScheduledEvent(client *redis.Client, evt, data string) error {
-	return client.Cmd("ZREM", "scheduled_events", evt+":"+data).Err
+// RemoveUniqueScheduledEvent removes the event scheduled with ScheduleUniqueEvent
+func RemoveUniqueScheduledEvent(client *redis.Client, name, key string) error {
+	fullKey := uniqueEventKey(name, key)
+
+	reply := client.Cmd("HGET", KeyScheduledEventsKeys, fullKey)
+	if reply.Err != nil {
+		return reply.Err
+	}
+	if reply.Type == redis.NilReply {
+		return nil
+	}
+
+	id, err := reply.Int64()
+	if err != nil {
+		return err
+	}
+
+	return evalScheduledScript(client, scriptRemove, id, fullKey).Err
 }
 
 var stopScheduledEventsChan = make(chan *sync.WaitGroup)
@@ -40,79 +239,239 @@ func StopSheduledEvents(wg *sync.WaitGroup) {
 }
 
 func NumScheduledEvents(client *redis.Client) (int, error) {
-	return client.Cmd("ZCARD", "scheduled_events").Int()
+	return client.Cmd("ZCARD", KeyScheduledEvents).Int()
 }
 
-// Checks for and handles scheduled events every minute
+// Checks for and handles scheduled events every second
 func RunScheduledEvents() {
 	client, err := RedisPool.Get()
 	if err != nil {
 		panic(err)
 	}
 
-	ticker := time.NewTicker(time.Minute)
+	err = migrateLegacyScheduledEvents(client)
+	if err != nil {
+		logrus.WithError(err).Error("Failed migrating legacy scheduled events")
+	}
+
+	ticker := time.NewTicker(time.Second)
+	lastRequeue := time.Now()
 	for {
 		select {
 		case wg := <-stopScheduledEventsChan:
+			RedisPool.Put(client)
 			wg.Done()
 			return
 		case <-ticker.C:
+			if time.Since(lastRequeue) > time.Second*10 {
+				lastRequeue = time.Now()
+				n, err := requeueStaleScheduledEvents(client)
+				if err != nil {
+					logrus.WithError(err).Error("Failed requeueing stale scheduled events")
+				} else if n > 0 {
+					logrus.Warnf("Requeued %d scheduled events that timed out while being handled", n)
+				}
+			}
+
 			started := time.Now()
 			n, err := checkScheduledEvents(client)
 			if err != nil {
 				logrus.WithError(err).Error("Failed checking scheduled events")
 			}
-			logrus.Infof("Handled %d scheduled events in %s", n, time.Since(started))
+			if n > 0 {
+				logrus.Infof("Handled %d scheduled events in %s", n, time.Since(started))
+			}
 		}
 	}
 }
 
+// Claims the due events and starts handling them
 func checkScheduledEvents(client *redis.Client) (int, error) {
 	now := time.Now()
-	reply := client.Cmd("ZRANGEBYSCORE", "scheduled_events", "-inf", now.Unix())
-	evts, err := reply.List()
-	if err != nil {
-		return 0, err
-	}
 
-	err = client.Cmd("ZREMRANGEBYSCORE", "scheduled_events", "-inf", now.Unix()).Err
+	ids, err := client.Cmd("EVAL", scriptMoveDue, 2, KeyScheduledEvents, KeyScheduledEventsProcessing, now.Unix(), now.Add(ScheduledEventClaimTimeout).Unix(), 1000).List()
 	if err != nil {
 		return 0, err
 	}
 
-	for _, v := range evts {
-		go handleScheduledEvent(v)
+	for _, id := range ids {
+		raw, err := client.Cmd("HGET", KeyScheduledEventsData, id).Bytes()
+		if err != nil {
+			// Removed in the meantime
+			client.Cmd("ZREM", KeyScheduledEventsProcessing, id)
+			continue
+		}
+
+		var evt *ScheduledEvent
+		err = json.Unmarshal(raw, &evt)
+		if err != nil {
+			logrus.WithError(err).WithField("sevt_id", id).Error("Failed decoding scheduled event")
+			client.Cmd("ZREM", KeyScheduledEventsProcessing, id)
+			client.Cmd("HDEL", KeyScheduledEventsData, id)
+			continue
+		}
+
+		go handleScheduledEvent(evt)
 	}
 
-	return len(evts), nil
+	return len(ids), nil
+}
+
+// Puts back events that has been claimed for longer than ScheduledEventClaimTimeout
+func requeueStaleScheduledEvents(client *redis.Client) (int, error) {
+	now := time.Now().Unix()
+	ids, err := client.Cmd("EVAL", scriptMoveDue, 2, KeyScheduledEventsProcessing, KeyScheduledEvents, now, now, 1000).List()
+	return len(ids), err
 }
 
-func handleScheduledEvent(evt string) {
-	split := strings.SplitN(evt, ":", 2)
-	rest := ""
-	if len(split) > 1 {
-		rest = split[1]
+func handleScheduledEvent(evt *ScheduledEvent) {
+	client, err := RedisPool.Get()
+	if err != nil {
+		// It will be requeued after the claim times out
+		logrus.WithError(err).Error("Failed retrieving redis connection from pool")
+		return
 	}
+	defer RedisPool.Put(client)
 
-	handler, found := scheduledHandlers[split[0]]
+	var handlerErr error
+
+	handler, found := scheduledHandlers[evt.Name]
 	if !found {
-		logrus.Warnf("No handler found for scheduled event %q", split[0])
+		logrus.Warnf("No handler found for scheduled event %q", evt.Name)
+		moveScheduledEventToDead(client, evt, "No handler")
 		return
 	}
 
-	handlerErr := handler(rest)
-	// Re-schedule the event if an error occured
-	if handlerErr != nil {
-		logrus.WithError(handlerErr).WithField("sevt", split[0]).Error("Failed handling scheduled event, re-scheduling.")
+	func() {
+		// Panics are treated as errors so that the event is retried
+		defer func() {
+			if r := recover(); r != nil {
+				handlerErr = fmt.Errorf("Recovered from panic: %v", r)
+			}
+		}()
+		handlerErr = handler(evt)
+	}()
 
-		client, err := RedisPool.Get()
+	if handlerErr == nil {
+		err = evalScheduledScript(client, scriptRemove, evt.ID, uniqueEventKey(evt.Name, evt.Key)).Err
 		if err != nil {
-			logrus.WithError(err).Error("Failed retrieving redis connection from pool")
-			return
+			logrus.WithError(err).WithField("sevt", evt.Name).Error("Failed removing handled scheduled event")
+		}
+		return
+	}
+
+	evt.Retries++
+	evt.LastError = handlerErr.Error()
+
+	if evt.Retries > ScheduledEventMaxRetries {
+		logrus.WithError(handlerErr).WithField("sevt", evt.Name).Error("Failed handling scheduled event too many times, giving up")
+		moveScheduledEventToDead(client, evt, handlerErr.Error())
+		return
+	}
+
+	backoff := scheduledEventBackoff(evt.Retries)
+
+	logrus.WithError(handlerErr).WithField("sevt", evt.Name).WithField("retries", evt.Retries).Error("Failed handling scheduled event, retrying in ", backoff)
+
+	serialized, err := json.Marshal(evt)
+	if err != nil {
+		logrus.WithError(err).Error("Failed encoding scheduled event")
+		return
+	}
+
+	err = evalScheduledScript(client, scriptRetry, evt.ID, time.Now().Add(backoff).Unix(), serialized).Err
+	if err != nil {
+		logrus.WithError(err).Error("Failed re-scheduling failed event")
+	}
+}
+
+// Returns how long to wait before the retry, doubled for each retry up to ScheduledEventMaxBackoff
+func scheduledEventBackoff(retries int) time.Duration {
+	backoff := ScheduledEventRetryBackoff * time.Duration(1<<uint(retries-1))
+	if backoff > ScheduledEventMaxBackoff || backoff <= 0 {
+		backoff = ScheduledEventMaxBackoff
+	}
+	return backoff
+}
+
+func moveScheduledEventToDead(client *redis.Client, evt *ScheduledEvent, reason string) {
+	evt.LastError = reason
+
+	serialized, err := json.Marshal(evt)
+	if err == nil {
+		client.Append("LPUSH", KeyScheduledEventsDead, serialized)
+		client.Append("LTRIM", KeyScheduledEventsDead, 0, ScheduledEventMaxDead-1)
+		_, err = GetRedisReplies(client, 2)
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("sevt", evt.Name).Error("Failed adding scheduled event to the dead letter list")
+	}
+
+	err = evalScheduledScript(client, scriptRemove, evt.ID, uniqueEventKey(evt.Name, evt.Key)).Err
+	if err != nil {
+		logrus.WithError(err).WithField("sevt", evt.Name).Error("Failed removing dead scheduled event")
+	}
+}
+
+// GetDeadScheduledEvents returns the latest events that failed too many times
+func GetDeadScheduledEvents(client *redis.Client, limit int) ([]*ScheduledEvent, error) {
+	raw, err := client.Cmd("LRANGE", KeyScheduledEventsDead, 0, limit-1).ListBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*ScheduledEvent, 0, len(raw))
+	for _, v := range raw {
+		var decoded *ScheduledEvent
+		if err := json.Unmarshal(v, &decoded); err != nil {
+			logrus.WithError(err).Error("Failed decoding dead scheduled event")
+			continue
 		}
-		err = ScheduleEvent(client, split[0], rest, time.Now())
+		result = append(result, decoded)
+	}
+	return result, nil
+}
+
+// Converts the events in the old "name:data" sorted set, the old data is used as the unique key
+// so they can be removed with RemoveUniqueScheduledEvent like before
+func migrateLegacyScheduledEvents(client *redis.Client) error {
+	legacy, err := client.Cmd("ZRANGE", KeyLegacyScheduledEvents, 0, -1, "WITHSCORES").List()
+	if err != nil {
+		return err
+	}
+
+	migrated := 0
+	for i := 0; i+1 < len(legacy); i += 2 {
+		member := legacy[i]
+		score, err := strconv.ParseInt(legacy[i+1], 10, 64)
+		if err != nil {
+			logrus.WithError(err).WithField("sevt", member).Error("Invalid legacy scheduled event score")
+			continue
+		}
+
+		split := strings.SplitN(member, ":", 2)
+		data := ""
+		if len(split) > 1 {
+			data = split[1]
+		}
+
+		id, serialized, err := newScheduledEvent(client, split[0], data, data, true)
+		if err != nil {
+			return err
+		}
+
+		// The legacy member is only removed together with adding the new event, so it isn't lost if this fails
+		// and only one process gets to migrate it
+		added, err := client.Cmd("EVAL", scriptMigrateLegacy, 5, KeyScheduledEvents, KeyScheduledEventsData, KeyScheduledEventsProcessing, KeyScheduledEventsKeys,
+			KeyLegacyScheduledEvents, id, score, serialized, uniqueEventKey(split[0], data), member).Int()
 		if err != nil {
-			logrus.WithError(err).Error("Failed re-scheduling failed event")
+			return err
 		}
+		migrated += added
+	}
+
+	if migrated > 0 {
+		logrus.Infof("Migrated %d legacy scheduled events", migrated)
 	}
+	return nil
 }
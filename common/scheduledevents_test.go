@@ -0,0 +1,281 @@
+package common
+
+import (
+	"encoding/json"
+	"github.com/fzzy/radix/redis"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// The script tests need a redis server, set YAGPDB_TEST_REDIS to its address to run them
+// Database 15 on it is flushed by the tests
+func testRedisClient(t *testing.T) *redis.Client {
+	addr := os.Getenv("YAGPDB_TEST_REDIS")
+	if addr == "" {
+		t.Skip("YAGPDB_TEST_REDIS not set")
+	}
+
+	client, err := redis.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal("Failed connecting to redis: ", err)
+	}
+
+	if err = client.Cmd("SELECT", 15).Err; err != nil {
+		t.Fatal(err)
+	}
+	if err = client.Cmd("FLUSHDB").Err; err != nil {
+		t.Fatal(err)
+	}
+
+	return client
+}
+
+func TestScheduledEventBackoff(t *testing.T) {
+	cases := []struct {
+		retries  int
+		expected time.Duration
+	}{
+		{1, ScheduledEventRetryBackoff},
+		{2, ScheduledEventRetryBackoff * 2},
+		{3, ScheduledEventRetryBackoff * 4},
+		{9, ScheduledEventRetryBackoff * 256},
+		{10, ScheduledEventMaxBackoff},
+		{100, ScheduledEventMaxBackoff},
+	}
+
+	for _, c := range cases {
+		if got := scheduledEventBackoff(c.retries); got != c.expected {
+			t.Errorf("scheduledEventBackoff(%d) = %s, expected %s", c.retries, got, c.expected)
+		}
+	}
+}
+
+type testLegacyData struct {
+	UserID string `json:"user_id"`
+}
+
+func (d *testLegacyData) ParseLegacy(data string) error {
+	d.UserID = data
+	return nil
+}
+
+func TestScheduledEventDecodeData(t *testing.T) {
+	cases := []struct {
+		name     string
+		evt      *ScheduledEvent
+		expected string
+	}{
+		{"json", &ScheduledEvent{Data: json.RawMessage(`{"user_id":"123"}`)}, "123"},
+		{"legacy", &ScheduledEvent{Data: json.RawMessage(`"456"`), Legacy: true}, "456"},
+	}
+
+	for _, c := range cases {
+		var data testLegacyData
+		err := c.evt.DecodeData(&data)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", c.name, err)
+			continue
+		}
+		if data.UserID != c.expected {
+			t.Errorf("%s: got user %q, expected %q", c.name, data.UserID, c.expected)
+		}
+	}
+}
+
+func TestScheduleUniqueEventReplaces(t *testing.T) {
+	client := testRedisClient(t)
+	defer client.Close()
+
+	when := time.Now().Add(time.Hour)
+	first, err := ScheduleUniqueEvent(client, "test", "a", nil, when)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := ScheduleUniqueEvent(client, "test", "a", nil, when)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n, _ := client.Cmd("ZCARD", KeyScheduledEvents).Int(); n != 1 {
+		t.Errorf("Expected 1 scheduled event, got %d", n)
+	}
+	if n, _ := client.Cmd("HLEN", KeyScheduledEventsData).Int(); n != 1 {
+		t.Errorf("Expected 1 event in the data hash, got %d", n)
+	}
+	if id, _ := client.Cmd("HGET", KeyScheduledEventsKeys, "test:a").Int64(); id != second {
+		t.Errorf("Expected the unique key to point at %d, got %d (first was %d)", second, id, first)
+	}
+
+	err = RemoveUniqueScheduledEvent(client, "test", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{KeyScheduledEvents, KeyScheduledEventsData, KeyScheduledEventsKeys} {
+		if exists, _ := client.Cmd("EXISTS", key).Bool(); exists {
+			t.Errorf("Expected %s to be empty after removing the event", key)
+		}
+	}
+}
+
+func TestScheduledEventsClaimAndRetry(t *testing.T) {
+	client := testRedisClient(t)
+	defer client.Close()
+
+	due, err := ScheduleEvent(client, "test", nil, time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ScheduleEvent(client, "test", nil, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().Unix()
+	claimed, err := client.Cmd("EVAL", scriptMoveDue, 2, KeyScheduledEvents, KeyScheduledEventsProcessing, now, now+60, 1000).List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claimed) != 1 || claimed[0] != strconv.FormatInt(due, 10) {
+		t.Fatalf("Expected only event %d to be claimed, got %v", due, claimed)
+	}
+	if n, _ := client.Cmd("ZCARD", KeyScheduledEvents).Int(); n != 1 {
+		t.Errorf("Expected 1 event left in the queue, got %d", n)
+	}
+
+	// Failed, put it back in the queue
+	retryAt := now + 10
+	retried, err := evalScheduledScript(client, scriptRetry, due, retryAt, `{}`).Int()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retried != 1 {
+		t.Error("Expected the event to be retried")
+	}
+	if score, _ := client.Cmd("ZSCORE", KeyScheduledEvents, due).Int64(); score != retryAt {
+		t.Errorf("Expected the retry to be scheduled at %d, got %d", retryAt, score)
+	}
+
+	// Removed while it was being handled, should not come back
+	client.Cmd("EVAL", scriptMoveDue, 2, KeyScheduledEvents, KeyScheduledEventsProcessing, retryAt, retryAt+60, 1000)
+	if err = RemoveScheduledEvent(client, due); err != nil {
+		t.Fatal(err)
+	}
+	retried, err = evalScheduledScript(client, scriptRetry, due, retryAt, `{}`).Int()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retried != 0 {
+		t.Error("Expected a removed event not to be retried")
+	}
+	if exists, _ := client.Cmd("HEXISTS", KeyScheduledEventsData, due).Bool(); exists {
+		t.Error("Expected a removed event to stay removed")
+	}
+}
+
+func TestRequeueStaleScheduledEvents(t *testing.T) {
+	client := testRedisClient(t)
+	defer client.Close()
+
+	id, err := ScheduleEvent(client, "test", nil, time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Claimed by a process that died, the claim timed out a minute ago
+	now := time.Now().Unix()
+	client.Cmd("EVAL", scriptMoveDue, 2, KeyScheduledEvents, KeyScheduledEventsProcessing, now, now-60, 1000)
+
+	n, err := requeueStaleScheduledEvents(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("Expected 1 requeued event, got %d", n)
+	}
+	if score, _ := client.Cmd("ZSCORE", KeyScheduledEvents, id).Int64(); score < now {
+		t.Error("Expected the event to be back in the queue")
+	}
+}
+
+func TestMoveScheduledEventToDead(t *testing.T) {
+	client := testRedisClient(t)
+	defer client.Close()
+
+	id, err := ScheduleUniqueEvent(client, "test", "dead", nil, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	moveScheduledEventToDead(client, &ScheduledEvent{ID: id, Name: "test", Key: "dead"}, "broken")
+
+	dead, err := GetDeadScheduledEvents(client, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dead) != 1 || dead[0].ID != id || dead[0].LastError != "broken" {
+		t.Errorf("Expected event %d in the dead letter list, got %v", id, dead)
+	}
+
+	for _, key := range []string{KeyScheduledEvents, KeyScheduledEventsData, KeyScheduledEventsKeys} {
+		if exists, _ := client.Cmd("EXISTS", key).Bool(); exists {
+			t.Errorf("Expected %s to be empty after the event died", key)
+		}
+	}
+}
+
+func TestMigrateLegacyScheduledEvents(t *testing.T) {
+	client := testRedisClient(t)
+	defer client.Close()
+
+	when := time.Now().Add(time.Hour).Unix()
+	client.Cmd("ZADD", KeyLegacyScheduledEvents, when, "test:123")
+
+	err := migrateLegacyScheduledEvents(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exists, _ := client.Cmd("EXISTS", KeyLegacyScheduledEvents).Bool(); exists {
+		t.Error("Expected the legacy events to be removed")
+	}
+
+	id, err := client.Cmd("HGET", KeyScheduledEventsKeys, "test:123").Int64()
+	if err != nil {
+		t.Fatal("Expected the migrated event to have the old data as unique key: ", err)
+	}
+
+	raw, err := client.Cmd("HGET", KeyScheduledEventsData, id).Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var evt *ScheduledEvent
+	err = json.Unmarshal(raw, &evt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var data testLegacyData
+	if err = evt.DecodeData(&data); err != nil || data.UserID != "123" {
+		t.Errorf("Expected the legacy data to decode to 123, got %q (%v)", data.UserID, err)
+	}
+	if score, _ := client.Cmd("ZSCORE", KeyScheduledEvents, id).Int64(); score != when {
+		t.Errorf("Expected the migrated event to trigger at %d, got %d", when, score)
+	}
+
+	// Already migrated by another process
+	added, err := client.Cmd("EVAL", scriptMigrateLegacy, 5, KeyScheduledEvents, KeyScheduledEventsData, KeyScheduledEventsProcessing, KeyScheduledEventsKeys,
+		KeyLegacyScheduledEvents, id+1, when, raw, "test:123", "test:123").Int()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added != 0 {
+		t.Error("Expected an already migrated event not to be added again")
+	}
+	if n, _ := client.Cmd("HLEN", KeyScheduledEventsData).Int(); n != 1 {
+		t.Errorf("Expected 1 event in the data hash, got %d", n)
+	}
+}
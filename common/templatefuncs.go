@@ -0,0 +1,473 @@
+package common
+
+// The standard template functions available in all templates
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jonas747/discordgo"
+	"math"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Max length of the sequence created by seq
+const MaxTemplateSeqLength = 10000
+
+func init() {
+	// For randInt and shuffle
+	rand.Seed(time.Now().UTC().UnixNano())
+
+	// Time
+	RegisterTemplateFunc("Time", "currentTime", "", "The current time in UTC", tmplCurrentTime)
+	RegisterTemplateFunc("Time", "formatTime", "time [layout]", "Formats the time using the Go layout, defaults to `Mon, 02 Jan 2006 15:04 MST`", tmplFormatTime)
+	RegisterTemplateFunc("Time", "humanizeDuration", "duration", "Formats a duration or number of seconds like `1 Hour, 5 Minutes, 3 Seconds`", tmplHumanizeDuration)
+	RegisterTemplateFunc("Time", "humanizeMinutes", "minutes", "Formats a number of minutes like `2 Days, 1 Hour, 0 Minutes`", tmplHumanizeMinutes)
+
+	// Math
+	RegisterTemplateFunc("Math", "add", "x y...", "Adds the numbers", tmplAdd)
+	RegisterTemplateFunc("Math", "sub", "x y", "Subtracts y from x", tmplSub)
+	RegisterTemplateFunc("Math", "mult", "x y...", "Multiplies the numbers", tmplMult)
+	RegisterTemplateFunc("Math", "div", "x y", "Divides x by y, integer division if both are integers", tmplDiv)
+	RegisterTemplateFunc("Math", "mod", "x y", "The remainder of x divided by y", tmplMod)
+	RegisterTemplateFunc("Math", "toInt", "x", "Converts a number or string to an integer", tmplToInt)
+	RegisterTemplateFunc("Math", "toFloat", "x", "Converts a number or string to a decimal number", tmplToFloat)
+	RegisterTemplateFunc("Math", "randInt", "[min] max", "A random integer in [min, max), min defaults to 0", tmplRandInt)
+	RegisterTemplateFunc("Math", "seq", "start stop", "A list of the integers in [start, stop)", tmplSequence)
+
+	// Strings
+	RegisterTemplateFunc("Strings", "lower", "str", "Converts to lower case", strings.ToLower)
+	RegisterTemplateFunc("Strings", "upper", "str", "Converts to upper case", strings.ToUpper)
+	RegisterTemplateFunc("Strings", "title", "str", "Capitalizes the first letter of every word", strings.Title)
+	RegisterTemplateFunc("Strings", "trimSpace", "str", "Removes leading and trailing whitespace", strings.TrimSpace)
+	RegisterTemplateFunc("Strings", "replace", "str old new", "Replaces all occurrences of old with new", tmplReplace)
+	RegisterTemplateFunc("Strings", "split", "str sep", "Splits the string into a list around sep", strings.Split)
+	RegisterTemplateFunc("Strings", "joinStr", "sep str...", "Joins the strings with sep in between", tmplJoinStrings)
+	RegisterTemplateFunc("Strings", "hasPrefix", "str prefix", "True if the string starts with prefix", strings.HasPrefix)
+	RegisterTemplateFunc("Strings", "hasSuffix", "str suffix", "True if the string ends with suffix", strings.HasSuffix)
+	RegisterTemplateFunc("Strings", "contains", "str substr", "True if substr is within the string", strings.Contains)
+	RegisterTemplateFunc("Strings", "cutString", "str length", "Cuts the string at length and adds `...` if it's longer than that", CutStringShort)
+	RegisterTemplateFunc("Strings", "str", "x", "Converts anything to a string", fmt.Sprint)
+	RegisterTemplateFunc("Strings", "shuffle", "list", "Returns the list or string in a random order", tmplShuffle)
+
+	// Mentions
+	RegisterTemplateFunc("Mentions", "mentionUser", "user", "Mentions a user, member or user id", tmplMentionUser)
+	RegisterTemplateFunc("Mentions", "mentionRole", "role", "Mentions a role or role id", tmplMentionRole)
+	RegisterTemplateFunc("Mentions", "mentionChannel", "channel", "Links a channel or channel id", tmplMentionChannel)
+
+	// Lookups
+	RegisterGuildTemplateFunc("Lookups", "getMember", "user", "Finds a member of the server by id or user, nil if not found", tmplGetMember)
+	RegisterGuildTemplateFunc("Lookups", "getRole", "role", "Finds a role on the server by id or name, nil if not found", tmplGetRole)
+	RegisterGuildTemplateFunc("Lookups", "getChannel", "channel", "Finds a channel on the server by id, name or mention, nil if not found", tmplGetChannel)
+}
+
+func tmplCurrentTime() time.Time {
+	return time.Now().UTC()
+}
+
+func tmplFormatTime(t time.Time, layout ...string) string {
+	if len(layout) > 0 && layout[0] != "" {
+		return t.Format(layout[0])
+	}
+	return t.Format("Mon, 02 Jan 2006 15:04 MST")
+}
+
+func tmplHumanizeDuration(d interface{}) (string, error) {
+	if duration, ok := d.(time.Duration); ok {
+		return HumanizeDuration(DurationPrecisionSeconds, duration), nil
+	}
+
+	seconds, _, err := tmplNumber(d)
+	if err != nil {
+		return "", err
+	}
+	return HumanizeDuration(DurationPrecisionSeconds, time.Duration(seconds*float64(time.Second))), nil
+}
+
+func tmplHumanizeMinutes(minutes interface{}) (string, error) {
+	f, _, err := tmplNumber(minutes)
+	if err != nil {
+		return "", err
+	}
+	// Without the seconds there's a trailing separator
+	return strings.TrimSuffix(HumanizeDuration(DurationPrecisionMinutes, time.Duration(f*float64(time.Minute))), ", "), nil
+}
+
+// Converts a template argument to a number, also returns wether it's a whole number without a decimal part
+func tmplNumber(v interface{}) (f float64, isInt bool, err error) {
+	switch t := v.(type) {
+	case int:
+		return float64(t), true, nil
+	case int32:
+		return float64(t), true, nil
+	case int64:
+		return float64(t), true, nil
+	case uint:
+		return float64(t), true, nil
+	case uint32:
+		return float64(t), true, nil
+	case uint64:
+		return float64(t), true, nil
+	case float32:
+		return float64(t), false, nil
+	case float64:
+		return t, false, nil
+	case string:
+		if i, err := strconv.ParseInt(t, 10, 64); err == nil {
+			return float64(i), true, nil
+		}
+		f, err := strconv.ParseFloat(t, 64)
+		if err != nil {
+			return 0, false, fmt.Errorf("%q is not a number", t)
+		}
+		return f, false, nil
+	}
+
+	return 0, false, fmt.Errorf("%v is not a number", v)
+}
+
+// Returns the result as a int if all the arguments were integers, otherwise as a float
+func tmplNumberResult(f float64, isInt bool) interface{} {
+	if isInt {
+		return int(f)
+	}
+	return f
+}
+
+// Folds op over all the numbers
+func tmplFoldNumbers(op func(a, b float64) float64, args []interface{}) (interface{}, error) {
+	if len(args) < 1 {
+		return 0, nil
+	}
+
+	result, allInts, err := tmplNumber(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range args[1:] {
+		f, isInt, err := tmplNumber(v)
+		if err != nil {
+			return nil, err
+		}
+		result = op(result, f)
+		allInts = allInts && isInt
+	}
+
+	return tmplNumberResult(result, allInts), nil
+}
+
+func tmplAdd(args ...interface{}) (interface{}, error) {
+	return tmplFoldNumbers(func(a, b float64) float64 { return a + b }, args)
+}
+
+func tmplSub(x, y interface{}) (interface{}, error) {
+	return tmplFoldNumbers(func(a, b float64) float64 { return a - b }, []interface{}{x, y})
+}
+
+func tmplMult(args ...interface{}) (interface{}, error) {
+	return tmplFoldNumbers(func(a, b float64) float64 { return a * b }, args)
+}
+
+func tmplDiv(x, y interface{}) (interface{}, error) {
+	a, aInt, err := tmplNumber(x)
+	if err != nil {
+		return nil, err
+	}
+	b, bInt, err := tmplNumber(y)
+	if err != nil {
+		return nil, err
+	}
+
+	if b == 0 {
+		return nil, errors.New("division by zero")
+	}
+
+	if aInt && bInt {
+		return int(a) / int(b), nil
+	}
+	return a / b, nil
+}
+
+func tmplMod(x, y interface{}) (interface{}, error) {
+	a, aInt, err := tmplNumber(x)
+	if err != nil {
+		return nil, err
+	}
+	b, bInt, err := tmplNumber(y)
+	if err != nil {
+		return nil, err
+	}
+
+	if b == 0 {
+		return nil, errors.New("division by zero")
+	}
+
+	return tmplNumberResult(math.Mod(a, b), aInt && bInt), nil
+}
+
+// Whole numbers are converted without going through a float64, so ids aren't rounded
+func tmplToInt(x interface{}) (int, error) {
+	switch t := x.(type) {
+	case int:
+		return t, nil
+	case int64:
+		return int(t), nil
+	case uint64:
+		return int(t), nil
+	case string:
+		if i, err := strconv.ParseInt(t, 10, 64); err == nil {
+			return int(i), nil
+		}
+	}
+
+	f, _, err := tmplNumber(x)
+	return int(f), err
+}
+
+func tmplToFloat(x interface{}) (float64, error) {
+	f, _, err := tmplNumber(x)
+	return f, err
+}
+
+func tmplRandInt(args ...interface{}) (int, error) {
+	min, max := 0, 0
+	switch len(args) {
+	case 1:
+		f, _, err := tmplNumber(args[0])
+		if err != nil {
+			return 0, err
+		}
+		max = int(f)
+	case 2:
+		f, _, err := tmplNumber(args[0])
+		if err != nil {
+			return 0, err
+		}
+		min = int(f)
+		f, _, err = tmplNumber(args[1])
+		if err != nil {
+			return 0, err
+		}
+		max = int(f)
+	default:
+		return 0, errors.New("randInt: takes 1 or 2 arguments")
+	}
+
+	if max <= min {
+		return 0, errors.New("randInt: max has to be larger than min")
+	}
+
+	return min + rand.Intn(max-min), nil
+}
+
+func tmplSequence(start, stop int) ([]int, error) {
+	if stop < start {
+		return nil, errors.New("seq: stop is smaller than start")
+	}
+
+	if stop-start > MaxTemplateSeqLength {
+		return nil, fmt.Errorf("seq: max %d elements", MaxTemplateSeqLength)
+	}
+
+	out := make([]int, stop-start)
+
+	ri := 0
+	for i := start; i < stop; i++ {
+		out[ri] = i
+		ri++
+	}
+	return out, nil
+}
+
+func tmplReplace(s, old, new string) string {
+	return strings.Replace(s, old, new, -1)
+}
+
+func tmplJoinStrings(sep string, args ...string) string {
+	return strings.Join(args, sep)
+}
+
+// tmplShuffle returns the given rangeable list in a randomised order.
+func tmplShuffle(seq interface{}) (interface{}, error) {
+	if seq == nil {
+		return nil, errors.New("both count and seq must be provided")
+	}
+
+	seqv := reflect.ValueOf(seq)
+	seqv, isNil := indirect(seqv)
+	if isNil {
+		return nil, errors.New("can't iterate over a nil value")
+	}
+
+	switch seqv.Kind() {
+	case reflect.Array, reflect.Slice, reflect.String:
+		// okay
+	default:
+		return nil, errors.New("can't iterate over " + reflect.ValueOf(seq).Type().String())
+	}
+
+	if seqv.Kind() == reflect.String {
+		runes := []rune(seqv.String())
+		for i, j := range rand.Perm(len(runes)) {
+			runes[i], runes[j] = runes[j], runes[i]
+		}
+		return string(runes), nil
+	}
+
+	shuffled := reflect.MakeSlice(reflect.SliceOf(seqv.Type().Elem()), seqv.Len(), seqv.Len())
+
+	randomIndices := rand.Perm(seqv.Len())
+
+	for index, value := range randomIndices {
+		shuffled.Index(value).Set(seqv.Index(index))
+	}
+
+	return shuffled.Interface(), nil
+}
+
+// indirect is taken from 'text/template/exec.go'
+func indirect(v reflect.Value) (rv reflect.Value, isNil bool) {
+	for ; v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface; v = v.Elem() {
+		if v.IsNil() {
+			return v, true
+		}
+		if v.Kind() == reflect.Interface && v.NumMethod() > 0 {
+			break
+		}
+	}
+	return v, false
+}
+
+// Returns the id of a user, member, role, channel or guild, or the argument itself if it's a id
+func tmplObjectID(v interface{}) string {
+	switch t := v.(type) {
+	case *discordgo.User:
+		if t != nil {
+			return t.ID
+		}
+	case *discordgo.Member:
+		if t != nil && t.User != nil {
+			return t.User.ID
+		}
+	case *discordgo.Role:
+		if t != nil {
+			return t.ID
+		}
+	case *discordgo.Channel:
+		if t != nil {
+			return t.ID
+		}
+	case *discordgo.Guild:
+		if t != nil {
+			return t.ID
+		}
+	case string:
+		return t
+	case int, int64, uint64:
+		return fmt.Sprint(t)
+	}
+
+	return ""
+}
+
+func tmplMentionUser(user interface{}) string {
+	return "<@" + tmplObjectID(user) + ">"
+}
+
+func tmplMentionRole(role interface{}) string {
+	return "<@&" + tmplObjectID(role) + ">"
+}
+
+func tmplMentionChannel(channel interface{}) string {
+	return "<#" + tmplObjectID(channel) + ">"
+}
+
+// Returns the guild from the state, which unlike most guild objects in template data has channels, roles and members
+func tmplStateGuild(guildID string) *discordgo.Guild {
+	if guildID == "" || BotSession == nil {
+		return nil
+	}
+
+	g, err := BotSession.State.Guild(guildID)
+	if err != nil {
+		return nil
+	}
+	return g
+}
+
+func tmplGetMember(guildID string) interface{} {
+	return func(user interface{}) *discordgo.Member {
+		g := tmplStateGuild(guildID)
+		if g == nil {
+			return nil
+		}
+
+		m, err := BotSession.State.Member(g.ID, tmplObjectID(user))
+		if err != nil {
+			return nil
+		}
+		return m
+	}
+}
+
+func tmplGetRole(guildID string) interface{} {
+	return func(role interface{}) *discordgo.Role {
+		g := tmplStateGuild(guildID)
+		if g == nil {
+			return nil
+		}
+
+		id := tmplObjectID(role)
+
+		BotSession.State.RLock()
+		defer BotSession.State.RUnlock()
+
+		for _, v := range g.Roles {
+			if v.ID == id {
+				return v
+			}
+		}
+
+		for _, v := range g.Roles {
+			if strings.EqualFold(v.Name, id) {
+				return v
+			}
+		}
+
+		return nil
+	}
+}
+
+func tmplGetChannel(guildID string) interface{} {
+	return func(channel interface{}) *discordgo.Channel {
+		g := tmplStateGuild(guildID)
+		if g == nil {
+			return nil
+		}
+
+		id := tmplObjectID(channel)
+		id = strings.TrimPrefix(strings.TrimSuffix(id, ">"), "<#")
+		id = strings.TrimPrefix(id, "#")
+
+		BotSession.State.RLock()
+		defer BotSession.State.RUnlock()
+
+		for _, v := range g.Channels {
+			if v.ID == id {
+				return v
+			}
+		}
+
+		for _, v := range g.Channels {
+			if strings.EqualFold(v.Name, id) {
+				return v
+			}
+		}
+
+		return nil
+	}
+}
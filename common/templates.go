@@ -0,0 +1,112 @@
+package common
+
+// The shared template function registry, every template executed through ParseExecuteTemplate has access to these functions
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"text/template"
+)
+
+// TemplateFunc is a documented template function
+type TemplateFunc struct {
+	Category    string
+	Name        string
+	Args        string
+	Description string
+
+	// Both nil for functions that are only documented here, but provided by a plugin when executing its own templates
+	Func interface{}
+	// Creates the function for the guild the template is executed in, for functions that look things up on the guild
+	GuildFunc func(guildID string) interface{}
+}
+
+var (
+	templateFuncs     = make(map[string]*TemplateFunc)
+	templateFuncOrder []string
+)
+
+// RegisterTemplateFunc adds a function available in all templates, should only be called during initialization
+func RegisterTemplateFunc(category, name, args, description string, f interface{}) {
+	if _, ok := templateFuncs[name]; !ok {
+		templateFuncOrder = append(templateFuncOrder, name)
+	}
+
+	templateFuncs[name] = &TemplateFunc{
+		Category:    category,
+		Name:        name,
+		Args:        args,
+		Description: description,
+		Func:        f,
+	}
+}
+
+// RegisterGuildTemplateFunc adds a function available in all templates that is bound to the guild the template is executed in,
+// f is called with the guild id for every execution so templates can't look at other guilds
+func RegisterGuildTemplateFunc(category, name, args, description string, f func(guildID string) interface{}) {
+	RegisterTemplateFunc(category, name, args, description, nil)
+	templateFuncs[name].GuildFunc = f
+}
+
+// DocumentTemplateFunc documents a function that a plugin only provides in its own templates (such as exec in custom commands)
+func DocumentTemplateFunc(category, name, args, description string) {
+	RegisterTemplateFunc(category, name, args, description, nil)
+}
+
+// TemplateFuncs returns a new FuncMap with all the registered functions, with the guild functions bound to guildID
+func TemplateFuncs(guildID string) template.FuncMap {
+	funcs := make(template.FuncMap)
+	for _, v := range templateFuncs {
+		if v.GuildFunc != nil {
+			funcs[v.Name] = v.GuildFunc(guildID)
+		} else if v.Func != nil {
+			funcs[v.Name] = v.Func
+		}
+	}
+	return funcs
+}
+
+// TemplateFuncDocs returns all the registered functions sorted by category and name
+func TemplateFuncDocs() []*TemplateFunc {
+	result := make([]*TemplateFunc, 0, len(templateFuncOrder))
+	for _, name := range templateFuncOrder {
+		result = append(result, templateFuncs[name])
+	}
+
+	sort.Sort(templateFuncsByCategory(result))
+	return result
+}
+
+type templateFuncsByCategory []*TemplateFunc
+
+func (t templateFuncsByCategory) Len() int      { return len(t) }
+func (t templateFuncsByCategory) Swap(i, j int) { t[i], t[j] = t[j], t[i] }
+func (t templateFuncsByCategory) Less(i, j int) bool {
+	if t[i].Category != t[j].Category {
+		return t[i].Category < t[j].Category
+	}
+	return t[i].Name < t[j].Name
+}
+
+// TemplateFuncsMarkdown generates the markdown documentation of the registered functions
+func TemplateFuncsMarkdown() string {
+	var buf bytes.Buffer
+	buf.WriteString("# Template functions\n\nAvailable in all templates unless noted otherwise.\n")
+
+	lastCategory := ""
+	for _, v := range TemplateFuncDocs() {
+		if v.Category != lastCategory {
+			fmt.Fprintf(&buf, "\n## %s\n\n| Function | Description |\n| --- | --- |\n", v.Category)
+			lastCategory = v.Category
+		}
+
+		usage := v.Name
+		if v.Args != "" {
+			usage += " " + v.Args
+		}
+		fmt.Fprintf(&buf, "| `%s` | %s |\n", usage, v.Description)
+	}
+
+	return buf.String()
+}
@@ -120,12 +120,14 @@ func GetGuild(client *redis.Client, guildID string) (guild *discordgo.Guild, err
 	return
 }
 
-func ParseExecuteTemplate(tmplSource string, data interface{}) (string, error) {
-	return ParseExecuteTemplateFM(tmplSource, data, nil)
+// ParseExecuteTemplate parses and executes the template with the shared template functions, lookups are limited to guildID
+func ParseExecuteTemplate(guildID, tmplSource string, data interface{}) (string, error) {
+	return ParseExecuteTemplateFM(guildID, tmplSource, data, nil)
 }
 
-func ParseExecuteTemplateFM(tmplSource string, data interface{}, f template.FuncMap) (string, error) {
-	tmpl := template.New("")
+// ParseExecuteTemplateFM is the same as ParseExecuteTemplate with additional functions, f takes precedence over the shared ones
+func ParseExecuteTemplateFM(guildID, tmplSource string, data interface{}, f template.FuncMap) (string, error) {
+	tmpl := template.New("").Funcs(TemplateFuncs(guildID))
 	if f != nil {
 		tmpl.Funcs(f)
 	}
@@ -197,6 +199,16 @@ func GetGuildMember(s *discordgo.Session, guildID, userID string) (m *discordgo.
 	return
 }
 
+// The epoch of discord snowflake ids (the first second of 2015) in milliseconds
+const DiscordEpoch = 1420070400000
+
+// SnowflakeTime returns the time a discord id (and the user, channel or message with it) was created
+func SnowflakeTime(id string) time.Time {
+	parsed, _ := strconv.ParseInt(id, 10, 64)
+	ms := (parsed >> 22) + DiscordEpoch
+	return time.Unix(ms/1000, (ms%1000)*int64(time.Millisecond))
+}
+
 type DurationFormatPrecision int
 
 const (
@@ -42,9 +42,29 @@ func HandleMessageCreate(s *discordgo.Session, evt *discordgo.MessageCreate, cli
 		return
 	}
 
+	var member *discordgo.Member
+
 	var matched *CustomCommand
 	for _, cmd := range cmds {
-		if CheckMatch(prefix, cmd, evt.Content) {
+		if !CheckMatch(prefix, cmd, evt.Content) {
+			continue
+		}
+
+		// Only fetch the member if needed
+		if member == nil && cmd.HasRoleRestrictions() {
+			member, err = common.GetGuildMember(s, channel.GuildID, evt.Author.ID)
+			if err != nil {
+				log.WithError(err).WithField("guild", channel.GuildID).Error("Failed retrieving member")
+				return
+			}
+		}
+
+		var roles []string
+		if member != nil {
+			roles = member.Roles
+		}
+
+		if cmd.CanRunIn(evt.ChannelID, roles) {
 			matched = cmd
 			break
 		}
@@ -54,6 +74,21 @@ func HandleMessageCreate(s *discordgo.Session, evt *discordgo.MessageCreate, cli
 		return
 	}
 
+	started, err := matched.TryStartCooldown(client, channel.GuildID, evt.Author.ID, evt.ChannelID)
+	if err != nil {
+		log.WithError(err).WithField("guild", channel.GuildID).Error("Failed starting custom command cooldown")
+		return
+	}
+	if !started {
+		// On cooldown
+		return
+	}
+
+	err = RecordCommandUse(client, channel.GuildID, matched.ID)
+	if err != nil {
+		log.WithError(err).WithField("guild", channel.GuildID).Error("Failed recording custom command use")
+	}
+
 	log.WithFields(log.Fields{
 		"trigger":      matched.Trigger,
 		"trigger_type": matched.TriggerType,
@@ -62,48 +97,117 @@ func HandleMessageCreate(s *discordgo.Session, evt *discordgo.MessageCreate, cli
 	}).Info("Custom command triggered")
 
 	out, err := ExecuteCustomCommand(matched, client, s, evt)
+	sendCommandResponse(s, channel.GuildID, evt.ChannelID, out, err)
+}
+
+// Sends the output of a custom command, including the error if execution stopped because of one
+func sendCommandResponse(s *discordgo.Session, guildID, channelID string, out string, err error) {
 	if err != nil {
 		if out == "" {
 			out += err.Error()
 		}
-		log.WithField("guild", channel.GuildID).WithError(err).Error("Error executing custom command")
+		log.WithField("guild", guildID).WithError(err).Error("Error executing custom command")
 		out += "\nAn error caused the execution of the custom command template to stop"
 	}
 
 	if out != "" {
-		_, err = s.ChannelMessageSend(evt.ChannelID, out)
+		_, err = s.ChannelMessageSend(channelID, out)
 		if err != nil {
 			log.WithError(err).Error("Failed sending message")
 		}
 	}
 }
 
-func ExecuteCustomCommand(cmd *CustomCommand, client *redis.Client, s *discordgo.Session, m *discordgo.MessageCreate) (string, error) {
-	channel := common.MustGetChannel(m.ChannelID)
+// ExecContext is the context a custom command is executed in
+type ExecContext struct {
+	GuildID string
+	// The channel the response is sent to
+	Channel *discordgo.Channel
+	// The user that triggered the command, nil for interval triggered commands
+	User *discordgo.User
 
-	data := map[string]interface{}{
-		"User":    m.Author,
-		"user":    m.Author,
-		"Channel": channel,
+	// The message that triggered the command, nil if it wasn't triggered by a message
+	Msg *discordgo.MessageCreate
+	// The id of the message that was reacted to, for reaction triggered commands
+	ReactionMessageID string
+
+	// Extra template data
+	Data map[string]interface{}
+
+	// Render the response without any side effects, used for previews in the control panel
+	DryRun bool
+}
+
+// MessageID returns the id of the message that triggered the command, or that was reacted to
+func (e *ExecContext) MessageID() string {
+	if e.Msg != nil {
+		return e.Msg.ID
 	}
+	return e.ReactionMessageID
+}
+
+func ExecuteCustomCommand(cmd *CustomCommand, client *redis.Client, s *discordgo.Session, m *discordgo.MessageCreate) (string, error) {
+	channel := common.MustGetChannel(m.ChannelID)
 
 	args := commandsystem.ReadArgs(m.Content)
 	argsStr := make([]string, len(args))
 	for k, v := range args {
 		argsStr[k] = v.Raw.Str
 	}
-	data["Args"] = argsStr
 
-	execUser, execBot := execCmdFuncs(3, false, client, s, m)
+	ctx := &ExecContext{
+		GuildID: channel.GuildID,
+		Channel: channel,
+		User:    m.Author,
+		Msg:     m,
+		Data: map[string]interface{}{
+			"Args": argsStr,
+		},
+	}
+
+	return ExecuteCustomCommandContext(cmd, client, s, ctx)
+}
 
-	//out, err := common.ParseExecuteTemplateFM(cmd.Response, data, template.FuncMap{"exec": execUser, "execBot": execBot})
-	out, err := common.ParseExecuteTemplateFM(cmd.Response, data, template.FuncMap{
+// ExecuteCustomCommandContext executes the custom command in any context, not just message triggered ones
+func ExecuteCustomCommandContext(cmd *CustomCommand, client *redis.Client, s *discordgo.Session, ctx *ExecContext) (string, error) {
+	data := map[string]interface{}{
+		"User":    ctx.User,
+		"user":    ctx.User,
+		"Channel": ctx.Channel,
+	}
+
+	if guild, err := s.State.Guild(ctx.GuildID); err == nil {
+		data["Server"] = guild
+	}
+
+	for k, v := range ctx.Data {
+		data[k] = v
+	}
+
+	var execUser, execBot cmdExecFunc
+	if ctx.Msg != nil {
+		execUser, execBot = execCmdFuncs(3, ctx.DryRun, client, s, ctx.Msg)
+	} else {
+		execUser = func(cmd string, args ...interface{}) (string, error) {
+			return "", errors.New("exec is only available in message triggered custom commands")
+		}
+		execBot = execUser
+	}
+
+	funcs := template.FuncMap{
 		"exec":    execUser,
 		"execBot": execBot,
-		"shuffle": shuffle,
-		"seq":     sequence,
-		"joinStr": joinStrings,
-	})
+	}
+
+	for k, v := range tmplDBFuncs(ctx.GuildID, ctx.DryRun) {
+		funcs[k] = v
+	}
+
+	for k, v := range tmplDiscordFuncs(s, ctx) {
+		funcs[k] = v
+	}
+
+	out, err := common.ParseExecuteTemplateFM(ctx.GuildID, cmd.Response, data, funcs)
 
 	if utf8.RuneCountInString(out) > 2000 {
 		out = "Custom command response was longer than 2k (contact an admin on the server...)"
@@ -219,6 +323,10 @@ func CheckMatch(globalPrefix string, cmd *CustomCommand, msg string) bool {
 	// set to globalprefix+" "+localprefix for command, and just local prefix for startwith
 	startsWith := ""
 
+	if cmd.TriggerType.IsEventTrigger() {
+		return false
+	}
+
 	trigger := cmd.Trigger
 
 	if !cmd.CaseSensitive && cmd.TriggerType != CommandTriggerRegex {
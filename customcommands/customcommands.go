@@ -18,10 +18,40 @@ func RegisterPlugin() {
 	plugin := &Plugin{}
 	web.RegisterPlugin(plugin)
 	bot.RegisterPlugin(plugin)
+	migrateDB()
+	common.RegisterScheduledEventHandler("cc_interval", handleIntervalEvent)
+	documentTemplateFuncs()
+}
+
+// The functions only available in custom commands, these are set up per execution
+func documentTemplateFuncs() {
+	const category = "Custom commands only"
+
+	common.DocumentTemplateFunc(category, "exec", "command args...", "Executes a bot command and returns the response, only in message triggered commands")
+	common.DocumentTemplateFunc(category, "execBot", "command args...", "Same as exec")
+
+	common.DocumentTemplateFunc(category, "dbSet", "user key value", "Stores the value under key, user 0 for server wide entries")
+	common.DocumentTemplateFunc(category, "dbGet", "user key", "Returns the value stored under key")
+	common.DocumentTemplateFunc(category, "dbIncr", "user key amount", "Increments the number stored under key and returns the new value")
+	common.DocumentTemplateFunc(category, "dbDel", "user key", "Deletes the entry")
+	common.DocumentTemplateFunc(category, "dbTopEntries", "key amount [skip]", "The entries with the highest numbers stored under key")
+
+	common.DocumentTemplateFunc(category, "cembed", "key value...", "Creates a embed, keys: title, description, url, color, footer, thumbnail, image, author and fields")
+	common.DocumentTemplateFunc(category, "cfield", "name value [inline]", "Creates a embed field")
+	common.DocumentTemplateFunc(category, "cslice", "values...", "Creates a list, for the embed fields")
+	common.DocumentTemplateFunc(category, "sendEmbed", "embed", "Sends the embed in the current channel")
+	common.DocumentTemplateFunc(category, "sendMessage", "channel message", "Sends a message or embed in another channel")
+	common.DocumentTemplateFunc(category, "sendDM", "message", "Sends a message or embed to the user in DM")
+	common.DocumentTemplateFunc(category, "addReactions", "emojis...", "Reacts to the triggering message")
+	common.DocumentTemplateFunc(category, "addRole", "role", "Gives the user the role")
+	common.DocumentTemplateFunc(category, "removeRole", "role", "Takes the role from the user")
 }
 
 func (p *Plugin) InitBot() {
 	common.BotSession.AddHandler(bot.CustomMessageCreate(HandleMessageCreate))
+	common.BotSession.AddHandler(bot.CustomGuildMemberAdd(HandleGuildMemberAdd))
+	common.BotSession.AddHandler(bot.CustomGuildMemberRemove(HandleGuildMemberRemove))
+	common.BotSession.AddHandler(bot.CustomMessageReactionAdd(HandleMessageReactionAdd))
 }
 
 func (p *Plugin) Name() string {
@@ -36,15 +66,77 @@ const (
 	CommandTriggerContains
 	CommandTriggerRegex
 	CommandTriggerExact
+
+	// Event triggers, these don't match messages
+	CommandTriggerJoin
+	CommandTriggerLeave
+	CommandTriggerReaction
+	CommandTriggerInterval
 )
 
+// IsEventTrigger returns true if the trigger type is triggered by something other than a message
+func (t CommandTriggerType) IsEventTrigger() bool {
+	return t >= CommandTriggerJoin
+}
+
 type CustomCommand struct {
 	TriggerType     CommandTriggerType `json:"trigger_type"`
 	TriggerTypeForm string             `json:"-" schema:"type"`
-	Trigger         string             `json:"trigger" schema:"trigger" valid:",1,2000"`
+	Trigger         string             `json:"trigger" schema:"trigger" valid:",2000"` // The emoji for reaction triggers, empty for any
 	Response        string             `json:"response" schema:"response" valid:",2000"`
 	CaseSensitive   bool               `json:"case_sensitive" schema:"case_sensitive"`
 	ID              int                `json:"id"`
+
+	// The channel join, leave and interval triggered commands respond in
+	Channel string `json:"channel" schema:"channel" valid:"channel,true"`
+	// Minutes between runs for interval triggered commands
+	IntervalMinutes int `json:"interval_minutes" schema:"interval_minutes" valid:"0,10080"`
+
+	// Cooldowns in seconds
+	UserCooldown    int `json:"user_cooldown" schema:"user_cooldown" valid:"0,86400"`
+	ChannelCooldown int `json:"channel_cooldown" schema:"channel_cooldown" valid:"0,86400"`
+
+	// If RequireRoles is set, the user needs atleast one of them, if they have any of the DenyRoles the command is ignored
+	RequireRoles []string `json:"require_roles" schema:"require_roles" valid:"role,true"`
+	DenyRoles    []string `json:"deny_roles" schema:"deny_roles" valid:"role,true"`
+
+	// Same as above but for the channel the command was used in
+	RequireChannels []string `json:"require_channels" schema:"require_channels" valid:"channel,true"`
+	DenyChannels    []string `json:"deny_channels" schema:"deny_channels" valid:"channel,true"`
+}
+
+// HasRoleRestrictions returns true if the command is restricted to or denied for certain roles
+func (cc *CustomCommand) HasRoleRestrictions() bool {
+	return len(cc.RequireRoles) > 0 || len(cc.DenyRoles) > 0
+}
+
+// CanRunIn returns true if the command is allowed to run in the channel for a member with the roles
+func (cc *CustomCommand) CanRunIn(channelID string, memberRoles []string) bool {
+	if containsString(cc.DenyChannels, channelID) {
+		return false
+	}
+
+	if len(cc.RequireChannels) > 0 && !containsString(cc.RequireChannels, channelID) {
+		return false
+	}
+
+	for _, r := range memberRoles {
+		if containsString(cc.DenyRoles, r) {
+			return false
+		}
+	}
+
+	if len(cc.RequireRoles) < 1 {
+		return true
+	}
+
+	for _, r := range memberRoles {
+		if containsString(cc.RequireRoles, r) {
+			return true
+		}
+	}
+
+	return false
 }
 
 func (cc *CustomCommand) Save(client *redis.Client, guildID string) error {
@@ -95,6 +187,35 @@ func GetCommands(client *redis.Client, guild string) ([]*CustomCommand, int, err
 	return result, highest, nil
 }
 
+func containsString(slice []string, s string) bool {
+	for _, v := range slice {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// GetCommand returns a single command, or nil if it dosen't exist
+func GetCommand(client *redis.Client, guildID string, id int) (*CustomCommand, error) {
+	reply := client.Cmd("HGET", KeyCommands(guildID), id)
+	if reply.Err != nil {
+		return nil, reply.Err
+	}
+	if reply.Type == redis.NilReply {
+		return nil, nil
+	}
+
+	raw, err := reply.Bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	var cmd *CustomCommand
+	err = json.Unmarshal(raw, &cmd)
+	return cmd, err
+}
+
 type CustomCommandSlice []*CustomCommand
 
 // Len is the number of elements in the collection.
@@ -0,0 +1,327 @@
+package customcommands
+
+// Persistent key/value storage for custom commands, entries are scoped per guild and per user (user 0 for guild wide entries)
+// Values are stored json encoded, numeric values are also stored in ValueNum so they can be sorted and incremented
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"github.com/jonas747/discordgo"
+	"github.com/jonas747/yagpdb/common"
+	"strconv"
+	"unicode/utf8"
+)
+
+const (
+	MaxDBEntriesPerGuild = 10000
+	MaxDBKeyLength       = 256
+	MaxDBValueSize       = 10000
+
+	// Max number of db calls in a single custom command execution
+	MaxDBCallsPerExec = 10
+)
+
+var (
+	ErrDBTooManyCalls   = errors.New("Max number of database calls in custom command")
+	ErrDBTooManyEntries = fmt.Errorf("Max %d database entries per server", MaxDBEntriesPerGuild)
+	ErrDBKeyTooLong     = fmt.Errorf("Database key too long (max %d)", MaxDBKeyLength)
+	ErrDBValueTooBig    = fmt.Errorf("Database value too big (max %d bytes)", MaxDBValueSize)
+)
+
+type DBEntry struct {
+	common.SmallModel
+
+	GuildID int64 `gorm:"index"`
+	UserID  int64
+	Key     string
+
+	Value    string // Json encoded
+	ValueNum float64
+}
+
+func (e *DBEntry) TableName() string {
+	return "custom_command_db_entries"
+}
+
+// DecodedValue returns the json decoded value
+func (e *DBEntry) DecodedValue() interface{} {
+	var v interface{}
+	err := json.Unmarshal([]byte(e.Value), &v)
+	if err != nil {
+		return e.Value
+	}
+	return v
+}
+
+func migrateDB() {
+	err := common.SQL.AutoMigrate(&DBEntry{}).Error
+	if err != nil {
+		panic(err)
+	}
+
+	common.SQL.Model(&DBEntry{}).AddUniqueIndex("idx_custom_command_db_entries_guild_user_key", "guild_id", "user_id", "key")
+}
+
+// Makes sure theres room for another entry, unless the entry already exists
+func checkDBEntryQuota(guildID, userID int64, key string) error {
+	count, err := CountDBEntries(guildID)
+	if err != nil {
+		return err
+	}
+
+	if count < MaxDBEntriesPerGuild {
+		return nil
+	}
+
+	exists := 0
+	err = common.SQL.Model(&DBEntry{}).Where("guild_id = ? AND user_id = ? AND key = ?", guildID, userID, key).Count(&exists).Error
+	if err != nil {
+		return err
+	}
+
+	if exists < 1 {
+		return ErrDBTooManyEntries
+	}
+	return nil
+}
+
+// SetDBEntry creates or updates a entry
+func SetDBEntry(guildID, userID int64, key string, value interface{}) error {
+	if utf8.RuneCountInString(key) > MaxDBKeyLength {
+		return ErrDBKeyTooLong
+	}
+
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	if len(encoded) > MaxDBValueSize {
+		return ErrDBValueTooBig
+	}
+
+	err = checkDBEntryQuota(guildID, userID, key)
+	if err != nil {
+		return err
+	}
+
+	num, _ := toFloat64(value)
+
+	const query = `INSERT INTO custom_command_db_entries (guild_id, user_id, key, value, value_num, created_at, updated_at)
+VALUES (?, ?, ?, ?, ?, now(), now())
+ON CONFLICT (guild_id, user_id, key) DO UPDATE SET value = EXCLUDED.value, value_num = EXCLUDED.value_num, updated_at = now()`
+
+	return common.SQL.Exec(query, guildID, userID, key, string(encoded), num).Error
+}
+
+// IncrDBEntry increments the numeric value of a entry, creating it if it dosen't exist, returns the new value
+func IncrDBEntry(guildID, userID int64, key string, incrBy float64) (float64, error) {
+	if utf8.RuneCountInString(key) > MaxDBKeyLength {
+		return 0, ErrDBKeyTooLong
+	}
+
+	err := checkDBEntryQuota(guildID, userID, key)
+	if err != nil {
+		return 0, err
+	}
+
+	const query = `INSERT INTO custom_command_db_entries (guild_id, user_id, key, value, value_num, created_at, updated_at)
+VALUES (?, ?, ?, ?, ?, now(), now())
+ON CONFLICT (guild_id, user_id, key) DO UPDATE SET
+	value_num = custom_command_db_entries.value_num + EXCLUDED.value_num,
+	value = (custom_command_db_entries.value_num + EXCLUDED.value_num)::text,
+	updated_at = now()
+RETURNING value_num`
+
+	var result float64
+	err = common.SQL.Raw(query, guildID, userID, key, strconv.FormatFloat(incrBy, 'f', -1, 64), incrBy).Row().Scan(&result)
+	return result, err
+}
+
+// GetDBEntry returns the entry, or nil if it dosen't exist
+func GetDBEntry(guildID, userID int64, key string) (*DBEntry, error) {
+	var entry DBEntry
+	err := common.SQL.Where("guild_id = ? AND user_id = ? AND key = ?", guildID, userID, key).First(&entry).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &entry, nil
+}
+
+func DelDBEntry(guildID, userID int64, key string) error {
+	return common.SQL.Where("guild_id = ? AND user_id = ? AND key = ?", guildID, userID, key).Delete(DBEntry{}).Error
+}
+
+// TopDBEntries returns the entries with the highest numeric values for the key
+func TopDBEntries(guildID int64, key string, limit, offset int) ([]*DBEntry, error) {
+	var result []*DBEntry
+	err := common.SQL.Where("guild_id = ? AND key = ?", guildID, key).Order("value_num desc").Limit(limit).Offset(offset).Find(&result).Error
+	if err == gorm.ErrRecordNotFound {
+		err = nil
+	}
+	return result, err
+}
+
+func CountDBEntries(guildID int64) (int, error) {
+	count := 0
+	err := common.SQL.Model(&DBEntry{}).Where("guild_id = ?", guildID).Count(&count).Error
+	return count, err
+}
+
+// ListDBEntries lists the entries in a guild for the control panel, optionally filtered by key and/or user
+func ListDBEntries(guildID int64, key string, userID int64, filterUser bool, limit, offset int) ([]*DBEntry, error) {
+	q := common.SQL.Where("guild_id = ?", guildID)
+	if key != "" {
+		q = q.Where("key = ?", key)
+	}
+	if filterUser {
+		q = q.Where("user_id = ?", userID)
+	}
+
+	var result []*DBEntry
+	err := q.Order("id desc").Limit(limit).Offset(offset).Find(&result).Error
+	if err == gorm.ErrRecordNotFound {
+		err = nil
+	}
+	return result, err
+}
+
+func DeleteDBEntryByID(guildID int64, id int64) error {
+	return common.SQL.Where("guild_id = ? AND id = ?", guildID, id).Delete(DBEntry{}).Error
+}
+
+// ClearDBEntries removes all the entries in a guild, returns the number of entries removed
+func ClearDBEntries(guildID int64) (int64, error) {
+	result := common.SQL.Where("guild_id = ?", guildID).Delete(DBEntry{})
+	return result.RowsAffected, result.Error
+}
+
+// Returns the db template functions for a custom command execution in guildID, in a dry run nothing is written
+func tmplDBFuncs(guildID string, dryRun bool) map[string]interface{} {
+	parsedGuildID := common.MustParseInt(guildID)
+
+	callsLeft := MaxDBCallsPerExec
+	checkCalls := func() error {
+		if callsLeft < 1 {
+			return ErrDBTooManyCalls
+		}
+		callsLeft--
+		return nil
+	}
+
+	return map[string]interface{}{
+		"dbSet": func(user interface{}, key string, value interface{}) (string, error) {
+			if err := checkCalls(); err != nil {
+				return "", err
+			}
+			if dryRun {
+				return "", nil
+			}
+			return "", SetDBEntry(parsedGuildID, tmplUserID(user), key, value)
+		},
+		"dbGet": func(user interface{}, key string) (interface{}, error) {
+			if err := checkCalls(); err != nil {
+				return nil, err
+			}
+			entry, err := GetDBEntry(parsedGuildID, tmplUserID(user), key)
+			if entry == nil || err != nil {
+				return "", err
+			}
+			return entry.DecodedValue(), nil
+		},
+		"dbIncr": func(user interface{}, key string, incrBy interface{}) (float64, error) {
+			if err := checkCalls(); err != nil {
+				return 0, err
+			}
+			f, ok := toFloat64(incrBy)
+			if !ok {
+				return 0, errors.New("dbIncr: incrBy has to be a number")
+			}
+			if dryRun {
+				// What the value would have been
+				entry, err := GetDBEntry(parsedGuildID, tmplUserID(user), key)
+				if entry == nil || err != nil {
+					return f, err
+				}
+				return entry.ValueNum + f, nil
+			}
+			return IncrDBEntry(parsedGuildID, tmplUserID(user), key, f)
+		},
+		"dbDel": func(user interface{}, key string) (string, error) {
+			if err := checkCalls(); err != nil {
+				return "", err
+			}
+			if dryRun {
+				return "", nil
+			}
+			return "", DelDBEntry(parsedGuildID, tmplUserID(user), key)
+		},
+		"dbTopEntries": func(key string, amount int, skip ...int) ([]*DBEntry, error) {
+			if err := checkCalls(); err != nil {
+				return nil, err
+			}
+			if amount > 100 || amount < 1 {
+				amount = 100
+			}
+			offset := 0
+			if len(skip) > 0 && skip[0] > 0 {
+				offset = skip[0]
+			}
+			return TopDBEntries(parsedGuildID, key, amount, offset)
+		},
+	}
+}
+
+// Converts the user argument of the db template functions to a user id, anything unknown is treated as 0 (the guild)
+func tmplUserID(user interface{}) int64 {
+	switch t := user.(type) {
+	case *discordgo.User:
+		return common.MustParseInt(t.ID)
+	case *discordgo.Member:
+		return common.MustParseInt(t.User.ID)
+	case string:
+		parsed, _ := strconv.ParseInt(t, 10, 64)
+		return parsed
+	// Ids don't fit in a float64 without rounding
+	case int:
+		return int64(t)
+	case int64:
+		return t
+	case uint64:
+		return int64(t)
+	}
+
+	f, _ := toFloat64(user)
+	return int64(f)
+}
+
+func toFloat64(v interface{}) (float64, bool) {
+	switch t := v.(type) {
+	case int:
+		return float64(t), true
+	case int32:
+		return float64(t), true
+	case int64:
+		return float64(t), true
+	case uint:
+		return float64(t), true
+	case uint32:
+		return float64(t), true
+	case uint64:
+		return float64(t), true
+	case float32:
+		return float64(t), true
+	case float64:
+		return t, true
+	case string:
+		f, err := strconv.ParseFloat(t, 64)
+		return f, err == nil
+	}
+
+	return 0, false
+}
@@ -0,0 +1,203 @@
+package customcommands
+
+// Custom commands triggered by events instead of messages: members joining or leaving, reactions and intervals
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/fzzy/radix/redis"
+	"github.com/jonas747/discordgo"
+	"github.com/jonas747/yagpdb/common"
+	"strconv"
+	"time"
+)
+
+const MinIntervalMinutes = 5
+
+// The data of the "cc_interval" scheduled event
+type IntervalEvtData struct {
+	GuildID string `json:"guild_id"`
+	CmdID   int    `json:"cmd_id"`
+}
+
+func intervalEvtKey(guildID string, cmdID int) string {
+	return guildID + ":" + strconv.Itoa(cmdID)
+}
+
+// UpdateIntervalEvent schedules the next run of a interval triggered command, or removes it if it's no longer one
+func UpdateIntervalEvent(client *redis.Client, guildID string, cmd *CustomCommand) error {
+	if cmd.TriggerType != CommandTriggerInterval || cmd.IntervalMinutes < MinIntervalMinutes || cmd.Channel == "" {
+		return common.RemoveUniqueScheduledEvent(client, "cc_interval", intervalEvtKey(guildID, cmd.ID))
+	}
+
+	when := time.Now().Add(time.Minute * time.Duration(cmd.IntervalMinutes))
+	_, err := common.ScheduleUniqueEvent(client, "cc_interval", intervalEvtKey(guildID, cmd.ID), &IntervalEvtData{GuildID: guildID, CmdID: cmd.ID}, when)
+	return err
+}
+
+func RemoveIntervalEvent(client *redis.Client, guildID string, cmdID int) error {
+	return common.RemoveUniqueScheduledEvent(client, "cc_interval", intervalEvtKey(guildID, cmdID))
+}
+
+func handleIntervalEvent(evt *common.ScheduledEvent) error {
+	var data IntervalEvtData
+	err := evt.DecodeData(&data)
+	if err != nil {
+		log.WithError(err).Error("Invalid custom command interval event")
+		return nil
+	}
+
+	client, err := common.RedisPool.Get()
+	if err != nil {
+		return err
+	}
+	defer common.RedisPool.Put(client)
+
+	cmd, err := GetCommand(client, data.GuildID, data.CmdID)
+	if err != nil {
+		return err
+	}
+
+	// Deleted or changed to another trigger in the meantime
+	if cmd == nil || cmd.TriggerType != CommandTriggerInterval {
+		return nil
+	}
+
+	// Schedule the next run first so that a failing command dosen't stop the interval
+	err = UpdateIntervalEvent(client, data.GuildID, cmd)
+	if err != nil {
+		return err
+	}
+
+	channel, err := common.BotSession.State.Channel(cmd.Channel)
+	if err != nil || channel.GuildID != data.GuildID {
+		return nil
+	}
+
+	runEventCommand(client, cmd, &ExecContext{
+		GuildID: data.GuildID,
+		Channel: channel,
+	})
+	return nil
+}
+
+func HandleGuildMemberAdd(s *discordgo.Session, evt *discordgo.GuildMemberAdd, client *redis.Client) {
+	handleMemberEvent(s, client, CommandTriggerJoin, evt.GuildID, evt.Member)
+}
+
+func HandleGuildMemberRemove(s *discordgo.Session, evt *discordgo.GuildMemberRemove, client *redis.Client) {
+	handleMemberEvent(s, client, CommandTriggerLeave, evt.GuildID, evt.Member)
+}
+
+func handleMemberEvent(s *discordgo.Session, client *redis.Client, triggerType CommandTriggerType, guildID string, member *discordgo.Member) {
+	cmds, _, err := GetCommands(client, guildID)
+	if err != nil {
+		log.WithError(err).WithField("guild", guildID).Error("Failed getting comamnds")
+		return
+	}
+
+	for _, cmd := range cmds {
+		if cmd.TriggerType != triggerType || cmd.Channel == "" {
+			continue
+		}
+
+		channel, err := s.State.Channel(cmd.Channel)
+		if err != nil || channel.GuildID != guildID {
+			continue
+		}
+
+		runEventCommand(client, cmd, &ExecContext{
+			GuildID: guildID,
+			Channel: channel,
+			User:    member.User,
+			Data: map[string]interface{}{
+				"Member": member,
+			},
+		})
+	}
+}
+
+func HandleMessageReactionAdd(s *discordgo.Session, evt *discordgo.MessageReactionAdd, client *redis.Client) {
+	if s.State.User == nil || s.State.User.ID == evt.UserID {
+		return // ignore ourselves
+	}
+
+	channel, err := s.State.Channel(evt.ChannelID)
+	if err != nil || channel.IsPrivate {
+		return
+	}
+
+	cmds, _, err := GetCommands(client, channel.GuildID)
+	if err != nil {
+		log.WithError(err).WithField("guild", channel.GuildID).Error("Failed getting comamnds")
+		return
+	}
+
+	var member *discordgo.Member
+	for _, cmd := range cmds {
+		if cmd.TriggerType != CommandTriggerReaction {
+			continue
+		}
+
+		if cmd.Trigger != "" && cmd.Trigger != evt.Emoji.Name && cmd.Trigger != evt.Emoji.ID {
+			continue
+		}
+
+		if member == nil {
+			member, err = common.GetGuildMember(s, channel.GuildID, evt.UserID)
+			if err != nil {
+				log.WithError(err).WithField("guild", channel.GuildID).Error("Failed retrieving member")
+				return
+			}
+
+			if member.User.Bot {
+				return // ignore bots
+			}
+		}
+
+		if !cmd.CanRunIn(channel.ID, member.Roles) {
+			continue
+		}
+
+		started, err := cmd.TryStartCooldown(client, channel.GuildID, evt.UserID, channel.ID)
+		if err != nil {
+			log.WithError(err).WithField("guild", channel.GuildID).Error("Failed starting custom command cooldown")
+			continue
+		}
+		if !started {
+			continue
+		}
+
+		runEventCommand(client, cmd, &ExecContext{
+			GuildID:           channel.GuildID,
+			Channel:           channel,
+			User:              member.User,
+			ReactionMessageID: evt.MessageID,
+			Data: map[string]interface{}{
+				"Member":    member,
+				"Reaction":  evt.Emoji,
+				"MessageID": evt.MessageID,
+			},
+		})
+	}
+}
+
+// Executes a event triggered command and sends the response
+func runEventCommand(client *redis.Client, cmd *CustomCommand, ctx *ExecContext) {
+	if cmd.Response == "" {
+		return
+	}
+
+	err := RecordCommandUse(client, ctx.GuildID, cmd.ID)
+	if err != nil {
+		log.WithError(err).WithField("guild", ctx.GuildID).Error("Failed recording custom command use")
+	}
+
+	log.WithFields(log.Fields{
+		"trigger_type": cmd.TriggerType,
+		"guild":        ctx.GuildID,
+		"channel_name": ctx.Channel.Name,
+	}).Info("Custom command triggered by event")
+
+	out, err := ExecuteCustomCommandContext(cmd, client, common.BotSession, ctx)
+	sendCommandResponse(common.BotSession, ctx.GuildID, ctx.Channel.ID, out, err)
+}
@@ -0,0 +1,315 @@
+package customcommands
+
+// Template functions for custom commands that interact with discord beyond the plain text response
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jonas747/discordgo"
+	"github.com/jonas747/yagpdb/bot"
+	"github.com/jonas747/yagpdb/common"
+	"strings"
+)
+
+// Max calls per custom command execution
+const (
+	MaxSendsPerExec     = 3 // sendMessage, sendEmbed and sendDM combined
+	MaxReactionsPerExec = 10
+	MaxRoleEditsPerExec = 5
+)
+
+var (
+	ErrTooManySends     = errors.New("Max number of messages sent in custom command")
+	ErrTooManyReactions = errors.New("Max number of reactions added in custom command")
+	ErrTooManyRoleEdits = errors.New("Max number of role changes in custom command")
+)
+
+// The state of a single custom command execution
+type discordTmplContext struct {
+	s    *discordgo.Session
+	exec *ExecContext
+
+	sendsLeft     int
+	reactionsLeft int
+	rolesLeft     int
+}
+
+// Returns the discord template functions for a custom command execution
+func tmplDiscordFuncs(s *discordgo.Session, exec *ExecContext) map[string]interface{} {
+	ctx := &discordTmplContext{
+		s:             s,
+		exec:          exec,
+		sendsLeft:     MaxSendsPerExec,
+		reactionsLeft: MaxReactionsPerExec,
+		rolesLeft:     MaxRoleEditsPerExec,
+	}
+
+	return map[string]interface{}{
+		"cembed":       createEmbed,
+		"cfield":       createEmbedField,
+		"cslice":       createSlice,
+		"sendEmbed":    ctx.tmplSendEmbed,
+		"sendMessage":  ctx.tmplSendMessage,
+		"sendDM":       ctx.tmplSendDM,
+		"addReactions": ctx.tmplAddReactions,
+		"addRole":      ctx.tmplAddRole,
+		"removeRole":   ctx.tmplRemoveRole,
+	}
+}
+
+func createSlice(values ...interface{}) []interface{} {
+	return values
+}
+
+// createEmbedField creates a embed field, for use with the "fields" key in cembed
+func createEmbedField(name, value string, inline ...bool) *discordgo.MessageEmbedField {
+	return &discordgo.MessageEmbedField{
+		Name:   name,
+		Value:  value,
+		Inline: len(inline) > 0 && inline[0],
+	}
+}
+
+// createEmbed creates a embed from key value pairs, example: cembed "title" "hello" "description" "world" "color" 4645612
+func createEmbed(values ...interface{}) (*discordgo.MessageEmbed, error) {
+	if len(values)%2 != 0 {
+		return nil, errors.New("cembed: needs key value pairs")
+	}
+
+	embed := &discordgo.MessageEmbed{}
+	for i := 0; i < len(values); i += 2 {
+		key, ok := values[i].(string)
+		if !ok {
+			return nil, errors.New("cembed: keys has to be strings")
+		}
+
+		value := values[i+1]
+		str := fmt.Sprint(value)
+
+		switch strings.ToLower(key) {
+		case "title":
+			embed.Title = str
+		case "description":
+			embed.Description = str
+		case "url":
+			embed.URL = str
+		case "color":
+			color, ok := toFloat64(value)
+			if !ok {
+				return nil, errors.New("cembed: color has to be a number")
+			}
+			embed.Color = int(color)
+		case "footer":
+			embed.Footer = &discordgo.MessageEmbedFooter{Text: str}
+		case "thumbnail":
+			embed.Thumbnail = &discordgo.MessageEmbedThumbnail{URL: str}
+		case "image":
+			embed.Image = &discordgo.MessageEmbedImage{URL: str}
+		case "author":
+			embed.Author = &discordgo.MessageEmbedAuthor{Name: str}
+		case "fields":
+			fields, ok := value.([]interface{})
+			if !ok {
+				return nil, errors.New("cembed: fields has to be a cslice of cfield")
+			}
+			for _, f := range fields {
+				field, ok := f.(*discordgo.MessageEmbedField)
+				if !ok {
+					return nil, errors.New("cembed: fields has to be a cslice of cfield")
+				}
+				embed.Fields = append(embed.Fields, field)
+			}
+		default:
+			return nil, errors.New("cembed: unknown key " + key)
+		}
+	}
+
+	return embed, nil
+}
+
+// Sends msg which can be either a embed or anything else which is formatted as text
+func (c *discordTmplContext) send(channelID string, msg interface{}) error {
+	if c.sendsLeft < 1 {
+		return ErrTooManySends
+	}
+	c.sendsLeft--
+
+	if c.exec.DryRun {
+		return nil
+	}
+
+	var err error
+	switch t := msg.(type) {
+	case *discordgo.MessageEmbed:
+		_, err = common.SendEmbedWithFallback(c.s, channelID, t)
+	default:
+		str := fmt.Sprint(msg)
+		if str == "" {
+			return nil
+		}
+		_, err = c.s.ChannelMessageSend(channelID, str)
+	}
+
+	return err
+}
+
+func (c *discordTmplContext) tmplSendEmbed(embed *discordgo.MessageEmbed) (string, error) {
+	return "", c.send(c.exec.Channel.ID, embed)
+}
+
+// Sends the message to another channel on the same server, channel can be a id, mention or name
+func (c *discordTmplContext) tmplSendMessage(channel string, msg interface{}) (string, error) {
+	channelID := c.findChannel(channel)
+	if channelID == "" {
+		return "", errors.New("sendMessage: unknown channel " + channel)
+	}
+
+	return "", c.send(channelID, msg)
+}
+
+func (c *discordTmplContext) tmplSendDM(msg interface{}) (string, error) {
+	if c.exec.User == nil {
+		return "", errors.New("sendDM: no user in this context")
+	}
+
+	if c.exec.DryRun {
+		return "", c.send("", msg)
+	}
+
+	privateChannel, err := bot.GetCreatePrivateChannel(c.s, c.exec.User.ID)
+	if err != nil {
+		return "", err
+	}
+
+	return "", c.send(privateChannel.ID, msg)
+}
+
+func (c *discordTmplContext) findChannel(channel string) string {
+	channel = strings.TrimPrefix(strings.TrimSuffix(channel, ">"), "<#")
+	channel = strings.TrimPrefix(channel, "#")
+
+	guild, err := c.s.State.Guild(c.exec.GuildID)
+	if err != nil {
+		return ""
+	}
+
+	c.s.State.RLock()
+	defer c.s.State.RUnlock()
+
+	for _, v := range guild.Channels {
+		if v.ID == channel {
+			return v.ID
+		}
+	}
+
+	for _, v := range guild.Channels {
+		if strings.EqualFold(v.Name, channel) && v.Type == "text" {
+			return v.ID
+		}
+	}
+
+	return ""
+}
+
+// Adds the reactions to the message that triggered the command
+func (c *discordTmplContext) tmplAddReactions(emojis ...string) (string, error) {
+	msgID := c.exec.MessageID()
+	if msgID == "" {
+		return "", errors.New("addReactions: no message in this context")
+	}
+
+	for _, emoji := range emojis {
+		if c.reactionsLeft < 1 {
+			return "", ErrTooManyReactions
+		}
+		c.reactionsLeft--
+
+		if c.exec.DryRun {
+			continue
+		}
+
+		// Custom emojis are in the form <:name:id> and animated ones <a:name:id>, the api wants name:id for both
+		if strings.HasPrefix(emoji, "<a:") {
+			emoji = strings.TrimPrefix(emoji, "<a:")
+		} else {
+			emoji = strings.TrimPrefix(emoji, "<:")
+		}
+		emoji = strings.TrimSuffix(emoji, ">")
+
+		err := c.s.MessageReactionAdd(c.exec.Channel.ID, msgID, emoji)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return "", nil
+}
+
+// Finds a role by id or name
+func (c *discordTmplContext) findRole(role string) string {
+	guild, err := c.s.State.Guild(c.exec.GuildID)
+	if err != nil {
+		return ""
+	}
+
+	c.s.State.RLock()
+	defer c.s.State.RUnlock()
+
+	for _, v := range guild.Roles {
+		if v.ID == role {
+			return v.ID
+		}
+	}
+
+	for _, v := range guild.Roles {
+		if strings.EqualFold(v.Name, role) {
+			return v.ID
+		}
+	}
+
+	return ""
+}
+
+func (c *discordTmplContext) tmplAddRole(role string) (string, error) {
+	if c.exec.User == nil {
+		return "", errors.New("addRole: no user in this context")
+	}
+
+	if c.rolesLeft < 1 {
+		return "", ErrTooManyRoleEdits
+	}
+	c.rolesLeft--
+
+	roleID := c.findRole(role)
+	if roleID == "" {
+		return "", errors.New("addRole: unknown role " + role)
+	}
+
+	if c.exec.DryRun {
+		return "", nil
+	}
+
+	return "", c.s.GuildMemberRoleAdd(c.exec.GuildID, c.exec.User.ID, roleID)
+}
+
+func (c *discordTmplContext) tmplRemoveRole(role string) (string, error) {
+	if c.exec.User == nil {
+		return "", errors.New("removeRole: no user in this context")
+	}
+
+	if c.rolesLeft < 1 {
+		return "", ErrTooManyRoleEdits
+	}
+	c.rolesLeft--
+
+	roleID := c.findRole(role)
+	if roleID == "" {
+		return "", errors.New("removeRole: unknown role " + role)
+	}
+
+	if c.exec.DryRun {
+		return "", nil
+	}
+
+	return "", c.s.GuildMemberRoleRemove(c.exec.GuildID, c.exec.User.ID, roleID)
+}
@@ -0,0 +1,107 @@
+package customcommands
+
+import (
+	"github.com/fzzy/radix/redis"
+	"github.com/jonas747/yagpdb/common"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Usage stats are kept out of the command itself so that saving a command in the control panel doesn't reset them
+func KeyCommandStats(guildID string) string { return "custom_commands_stats:" + guildID }
+
+func KeyCommandCooldown(guildID string, cmdID int, scope, id string) string {
+	return "custom_commands_cooldown:" + guildID + ":" + strconv.Itoa(cmdID) + ":" + scope + ":" + id
+}
+
+type CommandStats struct {
+	Uses     int64
+	LastUsed time.Time
+}
+
+// GetCommandStats returns the usage stats of the commands in a guild, keyed by command id
+func GetCommandStats(client *redis.Client, guildID string) (map[int]*CommandStats, error) {
+	hash, err := client.Cmd("HGETALL", KeyCommandStats(guildID)).Hash()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[int]*CommandStats)
+	for k, v := range hash {
+		split := strings.SplitN(k, ":", 2)
+		if len(split) < 2 {
+			continue
+		}
+
+		id, err := strconv.Atoi(split[0])
+		if err != nil {
+			continue
+		}
+
+		parsed, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			continue
+		}
+
+		stats, ok := result[id]
+		if !ok {
+			stats = &CommandStats{}
+			result[id] = stats
+		}
+
+		switch split[1] {
+		case "uses":
+			stats.Uses = parsed
+		case "last_used":
+			stats.LastUsed = time.Unix(parsed, 0)
+		}
+	}
+
+	return result, nil
+}
+
+// RecordCommandUse increments the usage counter and updates the last used time of the command
+func RecordCommandUse(client *redis.Client, guildID string, cmdID int) error {
+	idStr := strconv.Itoa(cmdID)
+	client.Append("HINCRBY", KeyCommandStats(guildID), idStr+":uses", 1)
+	client.Append("HSET", KeyCommandStats(guildID), idStr+":last_used", time.Now().Unix())
+	_, err := common.GetRedisReplies(client, 2)
+	return err
+}
+
+// RemoveCommandStats removes the usage stats of a deleted command
+func RemoveCommandStats(client *redis.Client, guildID string, cmdID string) error {
+	return client.Cmd("HDEL", KeyCommandStats(guildID), cmdID+":uses", cmdID+":last_used").Err
+}
+
+// TryStartCooldown puts the command on cooldown for the user and the channel, returns false if it already was on cooldown for either
+// The keys are only set if they don't exist so concurrent triggers can't both get past the cooldown
+func (cc *CustomCommand) TryStartCooldown(client *redis.Client, guildID, userID, channelID string) (bool, error) {
+	userKey := ""
+	if cc.UserCooldown > 0 {
+		userKey = KeyCommandCooldown(guildID, cc.ID, "u", userID)
+		reply := client.Cmd("SET", userKey, 1, "EX", cc.UserCooldown, "NX")
+		if reply.Err != nil {
+			return false, reply.Err
+		}
+		if reply.Type == redis.NilReply {
+			return false, nil
+		}
+	}
+
+	if cc.ChannelCooldown > 0 {
+		reply := client.Cmd("SET", KeyCommandCooldown(guildID, cc.ID, "c", channelID), 1, "EX", cc.ChannelCooldown, "NX")
+		if reply.Err == nil && reply.Type != redis.NilReply {
+			return true, nil
+		}
+
+		// The command isn't running, so don't keep the user on cooldown
+		if userKey != "" {
+			client.Cmd("DEL", userKey)
+		}
+		return false, reply.Err
+	}
+
+	return true, nil
+}
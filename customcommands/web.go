@@ -4,31 +4,78 @@ import (
 	"github.com/jonas747/discordgo"
 	"github.com/jonas747/yagpdb/common"
 	"github.com/jonas747/yagpdb/web"
+	"goji.io"
 	"goji.io/pat"
 	"golang.org/x/net/context"
 	"html/template"
 	"net/http"
+	"strconv"
+	"strings"
 	"unicode/utf8"
 )
 
 func (p *Plugin) InitWeb() {
-	web.Templates = template.Must(web.Templates.ParseFiles("templates/plugins/custom_commands.html"))
+	web.Templates = template.Must(web.Templates.ParseFiles("templates/plugins/custom_commands.html", "templates/plugins/custom_commands_db.html"))
+
+	subMux := goji.SubMux()
+	web.CPMux.Handle(pat.New("/customcommands"), subMux)
+	web.CPMux.Handle(pat.New("/customcommands/*"), subMux)
+
+	// Need the channels and roles for the restrictions
+	subMux.UseC(web.RequireGuildChannelsMiddleware)
+	subMux.UseC(web.RequireFullGuildMW)
 
 	getHandler := web.ControllerHandler(HandleCommands, "cp_custom_commands")
 
-	web.CPMux.HandleC(pat.Get("/customcommands"), getHandler)
-	web.CPMux.HandleC(pat.Get("/customcommands/"), getHandler)
+	subMux.HandleC(pat.Get(""), getHandler)
+	subMux.HandleC(pat.Get("/"), getHandler)
 
 	newHandler := web.ControllerPostHandler(HandleNewCommand, getHandler, CustomCommand{}, "Created a new custom command")
-	web.CPMux.HandleC(pat.Post("/customcommands"), newHandler)
-	web.CPMux.HandleC(pat.Post("/customcommands/"), newHandler)
+	subMux.HandleC(pat.Post(""), newHandler)
+	subMux.HandleC(pat.Post("/"), newHandler)
 
 	// If only html allowed patch and delete.. if only
-	//web.CPMux.HandleC(pat.Post("/customcommands"), web.FormParserMW(web.RenderHandler(HandleNewCommand, "cp_custom_commands"), CustomCommand{}))
-	//web.CPMux.HandleC(pat.Post("/customcommands/"), web.FormParserMW(web.RenderHandler(HandleNewCommand, "cp_custom_commands"), CustomCommand{}))
-	// web.CPMux.HandleC(pat.Post("/customcommands/:cmd/update"), web.FormParserMW(web.RenderHandler(HandleUpdateCommand, "cp_custom_commands"), CustomCommand{}))
-	web.CPMux.HandleC(pat.Post("/customcommands/:cmd/update"), web.ControllerPostHandler(HandleUpdateCommand, getHandler, CustomCommand{}, "Updated a custom command"))
-	web.CPMux.HandleC(pat.Post("/customcommands/:cmd/delete"), web.ControllerHandler(HandleDeleteCommand, "cp_custom_commands"))
+	subMux.HandleC(pat.Post("/:cmd/update"), web.ControllerPostHandler(HandleUpdateCommand, getHandler, CustomCommand{}, "Updated a custom command"))
+	subMux.HandleC(pat.Post("/:cmd/delete"), web.ControllerHandler(HandleDeleteCommand, "cp_custom_commands"))
+
+	dbHandler := web.ControllerHandler(HandleDatabase, "cp_custom_commands_db")
+	subMux.HandleC(pat.Get("/database"), dbHandler)
+	subMux.HandleC(pat.Get("/database/"), dbHandler)
+	subMux.HandleC(pat.Post("/database/clear"), web.ControllerHandler(HandleClearDatabase, "cp_custom_commands_db"))
+	subMux.HandleC(pat.Post("/database/:entry/delete"), web.ControllerHandler(HandleDeleteDatabaseEntry, "cp_custom_commands_db"))
+
+	web.RegisterTemplatePreview("customcommand", previewCustomCommand)
+}
+
+// Executes the response as a dry run in the channel being previewed in, or a sample channel
+func previewCustomCommand(ctx *web.TemplatePreviewContext, src string) (string, error) {
+	channel, err := common.BotSession.State.Channel(ctx.ChannelID)
+	if err != nil || channel.GuildID != ctx.Guild.ID {
+		channel = &discordgo.Channel{ID: ctx.Guild.ID, GuildID: ctx.Guild.ID, Name: "general", Type: "text"}
+	}
+
+	// A fake message so that exec can be checked as well
+	msg := &discordgo.MessageCreate{
+		Message: &discordgo.Message{
+			ChannelID: channel.ID,
+			Content:   strings.Join(ctx.Args, " "),
+			Author:    ctx.Member.User,
+		},
+	}
+
+	execCtx := &ExecContext{
+		GuildID: ctx.Guild.ID,
+		Channel: channel,
+		User:    ctx.Member.User,
+		Msg:     msg,
+		DryRun:  true,
+		Data: map[string]interface{}{
+			"Args":   ctx.Args,
+			"Member": ctx.Member,
+		},
+	}
+
+	return ExecuteCustomCommandContext(&CustomCommand{Response: src}, ctx.Client, common.BotSession, execCtx)
 }
 
 func HandleCommands(ctx context.Context, w http.ResponseWriter, r *http.Request) (web.TemplateData, error) {
@@ -43,6 +90,13 @@ func HandleCommands(ctx context.Context, w http.ResponseWriter, r *http.Request)
 		templateData["CustomCommands"] = commands
 	}
 
+	stats, err := GetCommandStats(client, activeGuild.ID)
+	if err != nil {
+		return templateData, err
+	}
+	templateData["CommandStats"] = stats
+	templateData["NewCustomCommand"] = &CustomCommand{}
+
 	return templateData, nil
 }
 
@@ -66,11 +120,21 @@ func HandleNewCommand(ctx context.Context, w http.ResponseWriter, r *http.Reques
 	newCmd.TriggerType = TriggerTypeFromForm(newCmd.TriggerTypeForm)
 	newCmd.ID = highest + 1
 
+	err = checkTriggerSettings(newCmd)
+	if err != nil {
+		return templateData, err
+	}
+
 	err = newCmd.Save(client, activeGuild.ID)
 	if err != nil {
 		return templateData, err
 	}
 
+	err = UpdateIntervalEvent(client, activeGuild.ID, newCmd)
+	if err != nil {
+		return templateData, err
+	}
+
 	templateData["CustomCommands"] = append(currentCommands, newCmd)
 	return templateData, nil
 }
@@ -89,8 +153,17 @@ func HandleUpdateCommand(ctx context.Context, w http.ResponseWriter, r *http.Req
 
 	cmd.TriggerType = TriggerTypeFromForm(cmd.TriggerTypeForm)
 
-	err := cmd.Save(client, activeGuild.ID)
+	err := checkTriggerSettings(cmd)
+	if err != nil {
+		return templateData, err
+	}
 
+	err = cmd.Save(client, activeGuild.ID)
+	if err != nil {
+		return templateData, err
+	}
+
+	err = UpdateIntervalEvent(client, activeGuild.ID, cmd)
 	return templateData, err
 }
 
@@ -105,12 +178,127 @@ func HandleDeleteCommand(ctx context.Context, w http.ResponseWriter, r *http.Req
 		return templateData, err
 	}
 
+	err = RemoveCommandStats(client, activeGuild.ID, cmdIndex)
+	if err != nil {
+		return templateData, err
+	}
+
+	if id, err := strconv.Atoi(cmdIndex); err == nil {
+		err = RemoveIntervalEvent(client, activeGuild.ID, id)
+		if err != nil {
+			return templateData, err
+		}
+	}
+
 	user := ctx.Value(common.ContextKeyUser).(*discordgo.User)
 	go common.AddCPLogEntry(user, activeGuild.ID, "Deleted command #"+cmdIndex)
 
 	return HandleCommands(ctx, w, r)
 }
 
+const dbEntriesPerPage = 50
+
+// Lists the database entries, optionally filtered by ?key= and ?user=
+func HandleDatabase(ctx context.Context, w http.ResponseWriter, r *http.Request) (web.TemplateData, error) {
+	_, activeGuild, templateData := web.GetBaseCPContextData(ctx)
+	templateData["VisibleURL"] = "/cp/" + activeGuild.ID + "/customcommands/database/"
+
+	guildID := common.MustParseInt(activeGuild.ID)
+
+	key := r.URL.Query().Get("key")
+	userStr := r.URL.Query().Get("user")
+	userID, err := strconv.ParseInt(userStr, 10, 64)
+	filterUser := err == nil
+
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 0 {
+		page = 0
+	}
+
+	entries, err := ListDBEntries(guildID, key, userID, filterUser, dbEntriesPerPage, page*dbEntriesPerPage)
+	if err != nil {
+		return templateData, err
+	}
+
+	count, err := CountDBEntries(guildID)
+	if err != nil {
+		return templateData, err
+	}
+
+	templateData["DBEntries"] = entries
+	templateData["DBEntryCount"] = count
+	templateData["DBMaxEntries"] = MaxDBEntriesPerGuild
+	templateData["FilterKey"] = key
+	if filterUser {
+		templateData["FilterUser"] = userStr
+	}
+	templateData["Page"] = page
+	templateData["PrevPage"] = page - 1
+	templateData["NextPage"] = page + 1
+	templateData["HasNextPage"] = len(entries) >= dbEntriesPerPage
+
+	return templateData, nil
+}
+
+func HandleDeleteDatabaseEntry(ctx context.Context, w http.ResponseWriter, r *http.Request) (web.TemplateData, error) {
+	_, activeGuild, templateData := web.GetBaseCPContextData(ctx)
+
+	id, err := strconv.ParseInt(pat.Param(ctx, "entry"), 10, 64)
+	if err != nil {
+		return templateData, web.NewPublicError("Invalid entry")
+	}
+
+	err = DeleteDBEntryByID(common.MustParseInt(activeGuild.ID), id)
+	if err != nil {
+		return templateData, err
+	}
+
+	user := ctx.Value(common.ContextKeyUser).(*discordgo.User)
+	go common.AddCPLogEntry(user, activeGuild.ID, "Deleted custom command database entry #"+pat.Param(ctx, "entry"))
+
+	return HandleDatabase(ctx, w, r)
+}
+
+func HandleClearDatabase(ctx context.Context, w http.ResponseWriter, r *http.Request) (web.TemplateData, error) {
+	_, activeGuild, templateData := web.GetBaseCPContextData(ctx)
+
+	n, err := ClearDBEntries(common.MustParseInt(activeGuild.ID))
+	if err != nil {
+		return templateData, err
+	}
+
+	user := ctx.Value(common.ContextKeyUser).(*discordgo.User)
+	go common.AddCPLogEntry(user, activeGuild.ID, "Cleared the custom command database ("+strconv.FormatInt(n, 10)+" entries)")
+
+	templateData.AddAlerts(web.SucessAlert("Removed ", n, " entries"))
+	return HandleDatabase(ctx, w, r)
+}
+
+// Checks the settings needed for the trigger type
+func checkTriggerSettings(cmd *CustomCommand) error {
+	switch cmd.TriggerType {
+	case CommandTriggerJoin, CommandTriggerLeave:
+		if cmd.Channel == "" {
+			return web.NewPublicError("Join and leave triggered commands needs a channel to respond in")
+		}
+	case CommandTriggerInterval:
+		if cmd.Channel == "" {
+			return web.NewPublicError("Interval triggered commands needs a channel to run in")
+		}
+		if cmd.IntervalMinutes < MinIntervalMinutes {
+			return web.NewPublicError("The interval has to be atleast ", MinIntervalMinutes, " minutes")
+		}
+	case CommandTriggerReaction:
+		// Empty trigger means any reaction
+	default:
+		if cmd.Trigger == "" {
+			return web.NewPublicError("Trigger can't be empty")
+		}
+	}
+
+	return nil
+}
+
 func TriggerTypeFromForm(str string) CommandTriggerType {
 	switch str {
 	case "prefix":
@@ -121,6 +309,14 @@ func TriggerTypeFromForm(str string) CommandTriggerType {
 		return CommandTriggerContains
 	case "exact":
 		return CommandTriggerExact
+	case "join":
+		return CommandTriggerJoin
+	case "leave":
+		return CommandTriggerLeave
+	case "reaction":
+		return CommandTriggerReaction
+	case "interval":
+		return CommandTriggerInterval
 	default:
 		return CommandTriggerCommand
 
@@ -3,21 +3,15 @@ package logs
 import (
 	"fmt"
 	"github.com/Sirupsen/logrus"
-	"github.com/bwmarrin/snowflake"
 	"github.com/fzzy/radix/redis"
 	"github.com/jinzhu/gorm"
 	"github.com/jonas747/discordgo"
 	"github.com/jonas747/dutil/commandsystem"
 	"github.com/jonas747/yagpdb/commands"
 	"github.com/jonas747/yagpdb/common"
-	"strconv"
 	"time"
 )
 
-func init() {
-	snowflake.Epoch = 1420070400000
-}
-
 func (p *Plugin) InitBot() {
 	common.BotSession.AddHandler(HandleGuildmemberUpdate)
 	common.BotSession.AddHandler(HandlePresenceUpdate)
@@ -96,9 +90,7 @@ var cmds = []commandsystem.CommandHandler{
 				joinedAtDurStr = "Lesss than an hour ago"
 			}
 
-			parsedId, _ := strconv.ParseInt(target.ID, 10, 64)
-			flake := snowflake.ID(parsedId)
-			t := time.Unix(flake.Time()/1000, 0)
+			t := common.SnowflakeTime(target.ID)
 			createdDurStr := common.HumanizeDuration(common.DurationPrecisionHours, time.Since(t))
 			if createdDurStr == "" {
 				createdDurStr = "Less than an hour ago"
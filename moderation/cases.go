@@ -0,0 +1,251 @@
+package moderation
+
+import (
+	"fmt"
+	"github.com/Sirupsen/logrus"
+	"github.com/jinzhu/gorm"
+	"github.com/jonas747/discordgo"
+	"github.com/jonas747/yagpdb/common"
+	"github.com/lib/pq"
+	"strconv"
+	"time"
+)
+
+// ModlogCase is a single moderation action stored in the database
+// Cases are numbered per guild, starting at 1
+type ModlogCase struct {
+	common.SmallModel
+
+	GuildID    int64 `gorm:"unique_index:idx_moderation_cases_guild_case"`
+	CaseNumber int64 `gorm:"unique_index:idx_moderation_cases_guild_case"`
+
+	UserID       int64 `gorm:"index"`
+	UserUsername string
+	UserDiscrim  string
+
+	ModID       int64
+	ModUsername string
+	ModDiscrim  string
+	ModAvatar   string
+
+	Action   string
+	Reason   string
+	Duration int // In minutes, 0 if not applicable
+	LogLink  string
+
+	// The message posted in the action channel, so it can be updated when the reason is changed
+	LogChannelID string
+	LogMessageID string
+}
+
+func (c *ModlogCase) TableName() string {
+	return "moderation_cases"
+}
+
+func (c *ModlogCase) Target() *discordgo.User {
+	return &discordgo.User{
+		ID:            strconv.FormatInt(c.UserID, 10),
+		Username:      c.UserUsername,
+		Discriminator: c.UserDiscrim,
+	}
+}
+
+// Returns nil if the moderator is not known (unbans through discord for example)
+func (c *ModlogCase) Moderator() *discordgo.User {
+	if c.ModID == 0 {
+		return nil
+	}
+
+	return &discordgo.User{
+		ID:            strconv.FormatInt(c.ModID, 10),
+		Username:      c.ModUsername,
+		Discriminator: c.ModDiscrim,
+		Avatar:        c.ModAvatar,
+	}
+}
+
+func (c *ModlogCase) Embed() *discordgo.MessageEmbed {
+	embed := CreateModlogEmbed(c.Moderator(), c.Action, c.Target(), c.Reason, c.LogLink)
+	embed.Title = fmt.Sprintf("Case #%d", c.CaseNumber)
+	embed.Timestamp = c.CreatedAt.UTC().Format(time.RFC3339)
+	return embed
+}
+
+// CreateCase stores a new case with the next available case number in the guild
+func CreateCase(guildID string, author *discordgo.User, action string, target *discordgo.User, reason, logLink string, duration int) (*ModlogCase, error) {
+	parsedGuild, err := strconv.ParseInt(guildID, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	modCase := &ModlogCase{
+		GuildID:      parsedGuild,
+		UserUsername: target.Username,
+		UserDiscrim:  target.Discriminator,
+		Action:       action,
+		Reason:       reason,
+		Duration:     duration,
+		LogLink:      logLink,
+	}
+
+	modCase.UserID, _ = strconv.ParseInt(target.ID, 10, 64)
+
+	if author != nil {
+		// Unknown authors have a non numeric id, those are left at 0
+		modCase.ModID, _ = strconv.ParseInt(author.ID, 10, 64)
+		modCase.ModUsername = author.Username
+		modCase.ModDiscrim = author.Discriminator
+		modCase.ModAvatar = author.Avatar
+	}
+
+	// The unique index on the guild and case number makes one of 2 actions at the same time fail, retry those with the next number
+	for i := 0; i < maxCaseRetries; i++ {
+		err = insertCase(modCase)
+		if !isUniqueViolation(err) {
+			break
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return modCase, nil
+}
+
+const maxCaseRetries = 5
+
+// Inserts the case with the next case number in the guild
+func insertCase(modCase *ModlogCase) error {
+	tx := common.SQL.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	var last ModlogCase
+	err := tx.Where("guild_id = ?", modCase.GuildID).Order("case_number desc").First(&last).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		tx.Rollback()
+		return err
+	}
+
+	modCase.ID = 0
+	modCase.CaseNumber = last.CaseNumber + 1
+
+	err = tx.Create(modCase).Error
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+func isUniqueViolation(err error) bool {
+	if cast, ok := err.(*pq.Error); ok {
+		return cast.Code == "23505"
+	}
+	return false
+}
+
+// GetCase returns the case by number in the guild
+func GetCase(guildID string, caseNumber int64) (*ModlogCase, error) {
+	var result ModlogCase
+	err := common.SQL.Where("guild_id = ? AND case_number = ?", guildID, caseNumber).First(&result).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// GetUserCases returns the latest cases for a user in the guild, newest first
+func GetUserCases(guildID, userID string, limit int) ([]*ModlogCase, error) {
+	var result []*ModlogCase
+	err := common.SQL.Where("guild_id = ? AND user_id = ?", guildID, userID).Order("case_number desc").Limit(limit).Find(&result).Error
+	if err == gorm.ErrRecordNotFound {
+		err = nil
+	}
+	return result, err
+}
+
+// GetGuildCases returns cases in the guild, newest first, before and after are case numbers
+// If userID is not empty only that users cases are returned
+func GetGuildCases(guildID, userID string, before, after int64, limit int) ([]*ModlogCase, error) {
+	q := common.SQL.Where("guild_id = ?", guildID)
+	if userID != "" {
+		q = q.Where("user_id = ?", userID)
+	}
+
+	if before != 0 {
+		q = q.Where("case_number < ?", before)
+	} else if after != 0 {
+		q = q.Where("case_number > ?", after)
+	}
+
+	var result []*ModlogCase
+	var err error
+	if after != 0 {
+		// Grab the ones right after, then flip them to keep newest first
+		err = q.Order("case_number asc").Limit(limit).Find(&result).Error
+		for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+			result[i], result[j] = result[j], result[i]
+		}
+	} else {
+		err = q.Order("case_number desc").Limit(limit).Find(&result).Error
+	}
+
+	if err == gorm.ErrRecordNotFound {
+		err = nil
+	}
+	return result, err
+}
+
+// UpdateReason changes the reason of the case and updates the message in the action channel if any
+func (c *ModlogCase) UpdateReason(reason string) error {
+	c.Reason = reason
+	err := common.SQL.Model(c).Update("reason", reason).Error
+	if err != nil {
+		return err
+	}
+
+	if c.LogMessageID == "" {
+		return nil
+	}
+
+	_, err = common.BotSession.ChannelMessageEditEmbed(c.LogChannelID, c.LogMessageID, c.Embed())
+	return err
+}
+
+// logAction stores the action as a case and posts it in the action channel if set
+func logAction(guildID, logChannel string, author *discordgo.User, action string, target *discordgo.User, reason, logLink string, duration int) error {
+	modCase, err := CreateCase(guildID, author, action, target, reason, logLink, duration)
+	if err != nil {
+		// Still post the action even tough it wasnt saved
+		logrus.WithError(err).WithField("guild", guildID).Error("Failed creating modlog case")
+	}
+
+	if logChannel == "" {
+		return nil
+	}
+
+	var embed *discordgo.MessageEmbed
+	if modCase != nil {
+		embed = modCase.Embed()
+	} else {
+		embed = CreateModlogEmbed(author, action, target, reason, logLink)
+	}
+
+	msg, err := common.BotSession.ChannelMessageSendEmbed(logChannel, embed)
+	if err != nil {
+		return err
+	}
+
+	if modCase != nil {
+		err = common.SQL.Model(modCase).Updates(map[string]interface{}{"log_channel_id": msg.ChannelID, "log_message_id": msg.ID}).Error
+		if err != nil {
+			logrus.WithError(err).WithField("guild", guildID).Error("Failed saving modlog message to case")
+		}
+	}
+
+	return nil
+}
@@ -28,20 +28,44 @@ func RegisterPlugin() {
 	web.RegisterPlugin(plugin)
 	bot.RegisterPlugin(plugin)
 	common.RegisterScheduledEventHandler("unmute", handleUnMute)
+	common.RegisterScheduledEventHandler("unban", handleUnban)
 	configstore.RegisterConfig(configstore.SQL, &Config{})
-	common.SQL.AutoMigrate(&Config{})
+	common.SQL.AutoMigrate(&Config{}, &ModlogCase{}, &WarningModel{})
 }
 
-func handleUnMute(data string) error {
+// ScheduledMemberEvtData is the data of the unmute and unban scheduled events
+type ScheduledMemberEvtData struct {
+	GuildID string `json:"guild_id"`
+	UserID  string `json:"user_id"`
+}
 
+// ParseLegacy parses the "guild:user" data of the old scheduled events
+func (s *ScheduledMemberEvtData) ParseLegacy(data string) error {
 	split := strings.Split(data, ":")
 	if len(split) < 2 {
-		logrus.Error("Invalid unmute event", data)
+		return errors.New("Invalid legacy event data: " + data)
+	}
+
+	s.GuildID = split[0]
+	s.UserID = split[1]
+	return nil
+}
+
+// The unique key of the unmute and unban events, only one of each can be scheduled per member
+func scheduledMemberEvtKey(guildID, userID string) string {
+	return guildID + ":" + userID
+}
+
+func handleUnMute(evt *common.ScheduledEvent) error {
+	var data ScheduledMemberEvtData
+	err := evt.DecodeData(&data)
+	if err != nil {
+		logrus.WithError(err).Error("Invalid unmute event")
 		return nil // Can't re-schedule an invalid event..
 	}
 
-	guildID := split[0]
-	userID := split[1]
+	guildID := data.GuildID
+	userID := data.UserID
 
 	member, err := common.BotSession.GuildMember(guildID, userID)
 	if err != nil {
@@ -64,6 +88,56 @@ func handleUnMute(data string) error {
 	return nil
 }
 
+func handleUnban(evt *common.ScheduledEvent) error {
+	var data ScheduledMemberEvtData
+	err := evt.DecodeData(&data)
+	if err != nil {
+		logrus.WithError(err).Error("Invalid unban event")
+		return nil // Can't re-schedule an invalid event..
+	}
+
+	guildID := data.GuildID
+	userID := data.UserID
+
+	client, err := common.RedisPool.Get()
+	if err != nil {
+		return err
+	}
+	defer common.RedisPool.Put(client)
+
+	// Let the ban remove handler know this unban is handled here
+	client.Cmd("SET", KeyUnbannedByBot(guildID, userID), true, "EX", 60)
+
+	err = common.BotSession.GuildBanDelete(guildID, userID)
+	if err != nil {
+		if cast, ok := err.(*discordgo.RESTError); ok && cast.Message != nil {
+			return nil // Discord api ok, something else went wrong (already unbanned manually for example). do not reschedule
+		}
+
+		return err
+	}
+
+	config, err := GetConfig(guildID)
+	if err != nil {
+		return err
+	}
+
+	user, err := common.BotSession.User(userID)
+	if err != nil {
+		user = &discordgo.User{
+			ID:            userID,
+			Username:      "Unknown",
+			Discriminator: "????",
+		}
+	}
+
+	return logAction(guildID, config.ActionChannel, common.BotSession.State.User.User, "Unbanned", user, "Ban duration expired", "", 0)
+}
+
+func KeyUnbannedByBot(guildID, userID string) string {
+	return "moderation_unbanned_by_bot:" + guildID + ":" + userID
+}
+
 type Config struct {
 	configstore.GuildConfigModel
 
@@ -84,6 +158,20 @@ type Config struct {
 	MuteReasonOptional   bool
 	UnmuteReasonOptional bool
 
+	// Warnings
+	WarnCommandsEnabled bool
+	WarnSendToModlog    bool
+	WarnExpireDays      int `valid:"0,365"`
+
+	// Punishments carried out when a user reaches a number of active warnings, 0 to disable
+	WarnMuteAfter    int `valid:"0,100"`
+	WarnMuteDuration int `valid:"0,1440"`
+	WarnKickAfter    int `valid:"0,100"`
+	WarnBanAfter     int `valid:"0,100"`
+
+	// Count automoderator violations as warnings, letting the thresholds above handle the punishments
+	WarnAutomodViolations bool
+
 	// Misc
 	CleanEnabled  bool
 	ReportEnabled bool
@@ -151,6 +239,8 @@ func CreateModlogEmbed(author *discordgo.User, action string, target *discordgo.
 	} else if strings.HasPrefix(action, "Unmuted") || action == "Unbanned" {
 		embed.Footer.IconURL = "https://" + common.Conf.Host + "/static/img/spugahtt.png"
 		embed.Color = 0x62c65f
+	} else if action == "Warned" {
+		embed.Color = 0xfca253
 	} else if strings.HasPrefix(action, "Banned") {
 		embed.Footer.IconURL = "https://" + common.Conf.Host + "/static/img/hummur.png"
 		embed.Color = 0xd64848
@@ -166,8 +256,18 @@ func CreateModlogEmbed(author *discordgo.User, action string, target *discordgo.
 	return embed
 }
 
+// DMTemplateData returns the data the kick and ban messages are executed with
+func DMTemplateData(user *discordgo.User, reason string, duration int) map[string]interface{} {
+	return map[string]interface{}{
+		"User":     user,
+		"Reason":   reason,
+		"Duration": duration,
+	}
+}
+
 // Kick or bans someone, uploading a hasebin log, and sending the report tmessage in the action channel
-func punish(config *Config, p Punishment, guildID, channelID string, author *discordgo.User, reason string, user *discordgo.User) error {
+// duration is in minutes and only used for bans, 0 for permanent
+func punish(config *Config, p Punishment, guildID, channelID string, author *discordgo.User, reason string, user *discordgo.User, duration int) error {
 	if author == nil {
 		author = &discordgo.User{
 			ID:            "??",
@@ -187,6 +287,9 @@ func punish(config *Config, p Punishment, guildID, channelID string, author *dis
 	actionStr := "Banned"
 	if p == PunishmentKick {
 		actionStr = "Kicked"
+		duration = 0
+	} else if duration > 0 {
+		actionStr = fmt.Sprintf("Banned (%d min)", duration)
 	}
 
 	actionChannel := config.ActionChannel
@@ -205,10 +308,7 @@ func punish(config *Config, p Punishment, guildID, channelID string, author *dis
 		dmMsg = "You were " + actionStr + "\nReason: {{.Reason}}"
 	}
 
-	executed, err := common.ParseExecuteTemplate(dmMsg, map[string]interface{}{
-		"User":   user,
-		"Reason": reason,
-	})
+	executed, err := common.ParseExecuteTemplate(guildID, dmMsg, DMTemplateData(user, reason, duration))
 
 	guild := common.MustGetGuild(guildID)
 	gName := "**" + guild.Name + ":** "
@@ -242,13 +342,7 @@ func punish(config *Config, p Punishment, guildID, channelID string, author *dis
 
 	logrus.Println("MODERATION:", author.Username, actionStr, user.Username, "cause", reason)
 
-	embed := CreateModlogEmbed(author, actionStr, user, reason, logLink)
-	_, err = common.BotSession.ChannelMessageSendEmbed(actionChannel, embed)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return logAction(guildID, actionChannel, author, actionStr, user, reason, logLink, duration)
 }
 
 func KickUser(config *Config, guildID, channelID string, author *discordgo.User, reason string, user *discordgo.User) error {
@@ -260,7 +354,7 @@ func KickUser(config *Config, guildID, channelID string, author *discordgo.User,
 		}
 	}
 
-	err := punish(config, PunishmentKick, guildID, channelID, author, reason, user)
+	err := punish(config, PunishmentKick, guildID, channelID, author, reason, user, 0)
 	if err != nil {
 		return err
 	}
@@ -295,7 +389,35 @@ func KickUser(config *Config, guildID, channelID string, author *discordgo.User,
 }
 
 func BanUser(config *Config, guildID, channelID string, author *discordgo.User, reason string, user *discordgo.User) error {
-	return punish(config, PunishmentBan, guildID, channelID, author, reason, user)
+	return BanUserWithDuration(config, nil, guildID, channelID, author, reason, user, 0)
+}
+
+// Bans a user and schedules an unban after duration minutes, or a permanent ban if duration is 0
+func BanUserWithDuration(config *Config, client *redis.Client, guildID, channelID string, author *discordgo.User, reason string, user *discordgo.User, duration int) error {
+	err := punish(config, PunishmentBan, guildID, channelID, author, reason, user, duration)
+	if err != nil {
+		return err
+	}
+
+	if client == nil {
+		client, err = common.RedisPool.Get()
+		if err != nil {
+			return err
+		}
+		defer common.RedisPool.Put(client)
+	}
+
+	// Either schedule the unban or remove a previously scheduled one, making this ban permanent
+	if duration > 0 {
+		_, err = common.ScheduleUniqueEvent(client, "unban", scheduledMemberEvtKey(guildID, user.ID), &ScheduledMemberEvtData{GuildID: guildID, UserID: user.ID}, time.Now().Add(time.Minute*time.Duration(duration)))
+	} else {
+		err = common.RemoveUniqueScheduledEvent(client, "unban", scheduledMemberEvtKey(guildID, user.ID))
+	}
+	if err != nil {
+		logrus.WithError(err).Error("Failed shceduling/removing unban event")
+	}
+
+	return nil
 }
 
 var (
@@ -359,10 +481,10 @@ func MuteUnmuteUser(config *Config, client *redis.Client, mute bool, guildID, ch
 
 	// Either remove the scheduled unmute or schedule an unmute in the future
 	if mute {
-		err = common.ScheduleEvent(client, "unmute", guildID+":"+user.ID, time.Now().Add(time.Minute*time.Duration(duration)))
+		_, err = common.ScheduleUniqueEvent(client, "unmute", scheduledMemberEvtKey(guildID, user.ID), &ScheduledMemberEvtData{GuildID: guildID, UserID: user.ID}, time.Now().Add(time.Minute*time.Duration(duration)))
 	} else {
 		if client != nil {
-			err = common.RemoveScheduledEvent(client, "unmute", guildID+":"+user.ID)
+			err = common.RemoveUniqueScheduledEvent(client, "unmute", scheduledMemberEvtKey(guildID, user.ID))
 		}
 	}
 	if err != nil {
@@ -394,11 +516,8 @@ func MuteUnmuteUser(config *Config, client *redis.Client, mute bool, guildID, ch
 	}
 	bot.SendDM(common.BotSession, user.ID, dmMsg)
 
-	if logChannel != "" {
-		embed := CreateModlogEmbed(author, action, user, reason, logLink)
-		_, err := common.BotSession.ChannelMessageSendEmbed(logChannel, embed)
-		return err
+	if !mute {
+		duration = 0
 	}
-
-	return nil
+	return logAction(guildID, logChannel, author, action, user, reason, logLink, duration)
 }
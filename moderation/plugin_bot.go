@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/Sirupsen/logrus"
 	"github.com/fzzy/radix/redis"
+	"github.com/jinzhu/gorm"
 	"github.com/jonas747/discordgo"
 	"github.com/jonas747/dutil"
 	"github.com/jonas747/dutil/commandsystem"
@@ -27,18 +28,27 @@ func (p *Plugin) InitBot() {
 }
 
 func HandleGuildBanRemove(s *discordgo.Session, r *discordgo.GuildBanRemove, client *redis.Client) {
+	byBot, _ := client.Cmd("EXISTS", KeyUnbannedByBot(r.GuildID, r.User.ID)).Bool()
+	if !byBot {
+		// Lifted by hand, so a pending temporary ban shouldn't unban them if they're banned again later
+		err := common.RemoveUniqueScheduledEvent(client, "unban", scheduledMemberEvtKey(r.GuildID, r.User.ID))
+		if err != nil {
+			logrus.WithError(err).WithField("guild", r.GuildID).Error("Failed removing scheduled unban")
+		}
+	}
+
 	config, err := GetConfig(r.GuildID)
 	if err != nil {
 		logrus.WithError(err).Error("Failed retrieving config")
 		return
 	}
 
-	if !config.LogUnbans || config.ActionChannel == "" {
+	// Expired temporary bans are logged by the unban event handler
+	if !config.LogUnbans || byBot {
 		return
 	}
 
-	embed := CreateModlogEmbed(nil, "Unbanned", r.User, "", "")
-	_, err = s.ChannelMessageSendEmbed(config.ActionChannel, embed)
+	err = logAction(r.GuildID, config.ActionChannel, nil, "Unbanned", r.User, "", "", 0)
 	if err != nil {
 		logrus.WithError(err).Error("Failed sending unban log message")
 	}
@@ -62,12 +72,14 @@ var ModerationCommands = []commandsystem.CommandHandler{
 		Category:      commands.CategoryModeration,
 		SimpleCommand: &commandsystem.SimpleCommand{
 			Name:         "Ban",
-			Description:  "Bans a member",
+			Description:  "Bans a member, optionally for a number of minutes after which they're unbanned",
 			RequiredArgs: 1,
 			Arguments: []*commandsystem.ArgumentDef{
 				&commandsystem.ArgumentDef{Name: "User", Type: commandsystem.ArgumentTypeUser},
+				&commandsystem.ArgumentDef{Name: "Minutes", Description: "Optional, bans permanently if not set", Type: commandsystem.ArgumentTypeNumber},
 				&commandsystem.ArgumentDef{Name: "Reason", Type: commandsystem.ArgumentTypeString},
 			},
+			ArgumentCombos: [][]int{[]int{0, 1, 2}, []int{0, 2}, []int{0, 1}, []int{0}},
 		},
 		RunFunc: func(parsed *commandsystem.ParsedCommand, client *redis.Client, m *discordgo.MessageCreate) (interface{}, error) {
 
@@ -83,15 +95,23 @@ var ModerationCommands = []commandsystem.CommandHandler{
 			}
 
 			reason := "(No reason specified)"
-			if parsed.Args[1] != nil && parsed.Args[1].Str() != "" {
-				reason = parsed.Args[1].Str()
+			if parsed.Args[2] != nil && parsed.Args[2].Str() != "" {
+				reason = parsed.Args[2].Str()
 			} else if !config.BanReasonOptional {
 				return "No reason specified", nil
 			}
 
+			duration := 0
+			if parsed.Args[1] != nil {
+				duration = parsed.Args[1].Int()
+				if duration < 1 || duration > 525600 {
+					return "Duration out of bounds (min 1, max 525600 - 1 year)", nil
+				}
+			}
+
 			target := parsed.Args[0].DiscordUser()
 
-			err = BanUser(config, parsed.Guild.ID, m.ChannelID, m.Author, reason, target)
+			err = BanUserWithDuration(config, client, parsed.Guild.ID, m.ChannelID, m.Author, reason, target, duration)
 			if err != nil {
 				if cast, ok := err.(*discordgo.RESTError); ok && cast.Message != nil {
 					return cast.Message.Message, err
@@ -466,6 +486,283 @@ var ModerationCommands = []commandsystem.CommandHandler{
 			return "No search is currently ongoign in this server", nil
 		},
 	},
+	&commands.CustomCommand{
+		Cooldown: 2,
+		Category: commands.CategoryModeration,
+		SimpleCommand: &commandsystem.SimpleCommand{
+			Name:         "Case",
+			Description:  "Shows a moderation case",
+			RequiredArgs: 1,
+			Arguments: []*commandsystem.ArgumentDef{
+				&commandsystem.ArgumentDef{Name: "Case", Type: commandsystem.ArgumentTypeNumber},
+			},
+		},
+		RunFunc: func(parsed *commandsystem.ParsedCommand, client *redis.Client, m *discordgo.MessageCreate) (interface{}, error) {
+			_, perm, err := BaseCmd(discordgo.PermissionKickMembers, m.Author.ID, m.ChannelID, parsed.Guild.ID)
+			if err != nil {
+				return "Error retrieving config.", err
+			}
+			if !perm {
+				return "You do not have kick permissions.", nil
+			}
+
+			modCase, err := GetCase(parsed.Guild.ID, int64(parsed.Args[0].Int()))
+			if err != nil {
+				if err == gorm.ErrRecordNotFound {
+					return "No case by that number found", nil
+				}
+				return "Failed retrieving case", err
+			}
+
+			return modCase.Embed(), nil
+		},
+	},
+	&commands.CustomCommand{
+		Cooldown: 2,
+		Category: commands.CategoryModeration,
+		SimpleCommand: &commandsystem.SimpleCommand{
+			Name:         "Reason",
+			Description:  "Changes the reason of a moderation case",
+			RequiredArgs: 2,
+			Arguments: []*commandsystem.ArgumentDef{
+				&commandsystem.ArgumentDef{Name: "Case", Type: commandsystem.ArgumentTypeNumber},
+				&commandsystem.ArgumentDef{Name: "Reason", Type: commandsystem.ArgumentTypeString},
+			},
+		},
+		RunFunc: func(parsed *commandsystem.ParsedCommand, client *redis.Client, m *discordgo.MessageCreate) (interface{}, error) {
+			_, perm, err := BaseCmd(discordgo.PermissionKickMembers, m.Author.ID, m.ChannelID, parsed.Guild.ID)
+			if err != nil {
+				return "Error retrieving config.", err
+			}
+			if !perm {
+				return "You do not have kick permissions.", nil
+			}
+
+			modCase, err := GetCase(parsed.Guild.ID, int64(parsed.Args[0].Int()))
+			if err != nil {
+				if err == gorm.ErrRecordNotFound {
+					return "No case by that number found", nil
+				}
+				return "Failed retrieving case", err
+			}
+
+			err = modCase.UpdateReason(parsed.Args[1].Str())
+			if err != nil {
+				if _, ok := err.(*discordgo.RESTError); ok {
+					// The case itself was updated, the log message was probably deleted
+					logrus.WithError(err).WithField("guild", parsed.Guild.ID).Warn("Failed updating modlog message")
+					return fmt.Sprintf("Updated case **#%d**, but failed updating the message in the action channel", modCase.CaseNumber), nil
+				}
+				return "Failed updating case", err
+			}
+
+			return fmt.Sprintf("Updated the reason of case **#%d**", modCase.CaseNumber), nil
+		},
+	},
+	&commands.CustomCommand{
+		Cooldown: 5,
+		Category: commands.CategoryModeration,
+		SimpleCommand: &commandsystem.SimpleCommand{
+			Name:         "Cases",
+			Aliases:      []string{"modlogs", "history"},
+			Description:  "Lists the latest moderation cases of a user",
+			RequiredArgs: 1,
+			Arguments: []*commandsystem.ArgumentDef{
+				&commandsystem.ArgumentDef{Name: "User", Type: commandsystem.ArgumentTypeUser},
+			},
+		},
+		RunFunc: func(parsed *commandsystem.ParsedCommand, client *redis.Client, m *discordgo.MessageCreate) (interface{}, error) {
+			_, perm, err := BaseCmd(discordgo.PermissionKickMembers, m.Author.ID, m.ChannelID, parsed.Guild.ID)
+			if err != nil {
+				return "Error retrieving config.", err
+			}
+			if !perm {
+				return "You do not have kick permissions.", nil
+			}
+
+			target := parsed.Args[0].DiscordUser()
+
+			cases, err := GetUserCases(parsed.Guild.ID, target.ID, 25)
+			if err != nil {
+				return "Failed retrieving cases", err
+			}
+
+			if len(cases) < 1 {
+				return fmt.Sprintf("**%s#%s** has no cases on this server", target.Username, target.Discriminator), nil
+			}
+
+			out := fmt.Sprintf("Latest cases for **%s#%s**:\n", target.Username, target.Discriminator)
+			out += stringCases(cases)
+			out += "\nView a case in detail with `case (number)`"
+			return out, nil
+		},
+	},
+	&commands.CustomCommand{
+		CustomEnabled: true,
+		Cooldown:      5,
+		Category:      commands.CategoryModeration,
+		SimpleCommand: &commandsystem.SimpleCommand{
+			Name:         "Warn",
+			Description:  "Warns a member, warnings can be viewed with the warnings command",
+			RequiredArgs: 2,
+			Arguments: []*commandsystem.ArgumentDef{
+				&commandsystem.ArgumentDef{Name: "User", Type: commandsystem.ArgumentTypeUser},
+				&commandsystem.ArgumentDef{Name: "Reason", Type: commandsystem.ArgumentTypeString},
+			},
+		},
+		RunFunc: func(parsed *commandsystem.ParsedCommand, client *redis.Client, m *discordgo.MessageCreate) (interface{}, error) {
+			config, perm, err := BaseCmd(discordgo.PermissionManageMessages, m.Author.ID, m.ChannelID, parsed.Guild.ID)
+			if err != nil {
+				return "Error retrieving config.", err
+			}
+			if !perm {
+				return "You do not have manage messages permissions in this channel.", nil
+			}
+			if !config.WarnCommandsEnabled {
+				return "Warning commands disabled.", nil
+			}
+
+			target := parsed.Args[0].DiscordUser()
+
+			err = WarnUser(config, client, parsed.Guild.ID, m.ChannelID, m.Author, target, parsed.Args[1].Str())
+			if err != nil {
+				if cast, ok := err.(*discordgo.RESTError); ok && cast.Message != nil {
+					return "API Error: " + cast.Message.Message, err
+				} else {
+					return "An error occurred", err
+				}
+			}
+
+			return fmt.Sprintf("Warned **%s#%s**", target.Username, target.Discriminator), nil
+		},
+	},
+	&commands.CustomCommand{
+		CustomEnabled: true,
+		Cooldown:      5,
+		Category:      commands.CategoryModeration,
+		SimpleCommand: &commandsystem.SimpleCommand{
+			Name:         "Warnings",
+			Description:  "Lists the active warnings of a member",
+			RequiredArgs: 1,
+			Arguments: []*commandsystem.ArgumentDef{
+				&commandsystem.ArgumentDef{Name: "User", Type: commandsystem.ArgumentTypeUser},
+			},
+		},
+		RunFunc: func(parsed *commandsystem.ParsedCommand, client *redis.Client, m *discordgo.MessageCreate) (interface{}, error) {
+			config, perm, err := BaseCmd(discordgo.PermissionManageMessages, m.Author.ID, m.ChannelID, parsed.Guild.ID)
+			if err != nil {
+				return "Error retrieving config.", err
+			}
+			if !perm {
+				return "You do not have manage messages permissions in this channel.", nil
+			}
+			if !config.WarnCommandsEnabled {
+				return "Warning commands disabled.", nil
+			}
+
+			target := parsed.Args[0].DiscordUser()
+
+			warnings, err := GetWarnings(config, parsed.Guild.ID, target.ID)
+			if err != nil {
+				return "Failed retrieving warnings", err
+			}
+
+			if len(warnings) < 1 {
+				return fmt.Sprintf("**%s#%s** has no active warnings", target.Username, target.Discriminator), nil
+			}
+
+			out := fmt.Sprintf("**%s#%s** has %d active warning(s):\n", target.Username, target.Discriminator, len(warnings))
+			for _, v := range warnings {
+				out += fmt.Sprintf("**%d**: %s - by %s (%s)\n", v.ID, v.Message, v.AuthorUsername, v.CreatedAt.UTC().Format(time.RFC822))
+			}
+			out += "\nRemove a warning with `delwarning (id)` or all of them with `clearwarnings @user`"
+			return out, nil
+		},
+	},
+	&commands.CustomCommand{
+		CustomEnabled: true,
+		Cooldown:      5,
+		Category:      commands.CategoryModeration,
+		SimpleCommand: &commandsystem.SimpleCommand{
+			Name:         "ClearWarnings",
+			Aliases:      []string{"clw"},
+			Description:  "Removes all the warnings of a member",
+			RequiredArgs: 1,
+			Arguments: []*commandsystem.ArgumentDef{
+				&commandsystem.ArgumentDef{Name: "User", Type: commandsystem.ArgumentTypeUser},
+			},
+		},
+		RunFunc: func(parsed *commandsystem.ParsedCommand, client *redis.Client, m *discordgo.MessageCreate) (interface{}, error) {
+			config, perm, err := BaseCmd(discordgo.PermissionManageMessages, m.Author.ID, m.ChannelID, parsed.Guild.ID)
+			if err != nil {
+				return "Error retrieving config.", err
+			}
+			if !perm {
+				return "You do not have manage messages permissions in this channel.", nil
+			}
+			if !config.WarnCommandsEnabled {
+				return "Warning commands disabled.", nil
+			}
+
+			target := parsed.Args[0].DiscordUser()
+
+			n, err := ClearWarnings(parsed.Guild.ID, target.ID)
+			if err != nil {
+				return "Failed clearing warnings", err
+			}
+
+			return fmt.Sprintf("Removed %d warning(s) from **%s#%s**", n, target.Username, target.Discriminator), nil
+		},
+	},
+	&commands.CustomCommand{
+		CustomEnabled: true,
+		Cooldown:      2,
+		Category:      commands.CategoryModeration,
+		SimpleCommand: &commandsystem.SimpleCommand{
+			Name:         "DelWarning",
+			Aliases:      []string{"dw", "rmwarning"},
+			Description:  "Removes a single warning",
+			RequiredArgs: 1,
+			Arguments: []*commandsystem.ArgumentDef{
+				&commandsystem.ArgumentDef{Name: "ID", Type: commandsystem.ArgumentTypeNumber},
+			},
+		},
+		RunFunc: func(parsed *commandsystem.ParsedCommand, client *redis.Client, m *discordgo.MessageCreate) (interface{}, error) {
+			config, perm, err := BaseCmd(discordgo.PermissionManageMessages, m.Author.ID, m.ChannelID, parsed.Guild.ID)
+			if err != nil {
+				return "Error retrieving config.", err
+			}
+			if !perm {
+				return "You do not have manage messages permissions in this channel.", nil
+			}
+			if !config.WarnCommandsEnabled {
+				return "Warning commands disabled.", nil
+			}
+
+			found, err := DeleteWarning(parsed.Guild.ID, parsed.Args[0].Int())
+			if err != nil {
+				return "Failed removing warning", err
+			}
+
+			if !found {
+				return "No warning by that id found", nil
+			}
+
+			return fmt.Sprintf("Removed warning **#%d**", parsed.Args[0].Int()), nil
+		},
+	},
+}
+
+func stringCases(cases []*ModlogCase) string {
+	out := ""
+	for _, v := range cases {
+		mod := "Unknown"
+		if v.ModID != 0 {
+			mod = v.ModUsername + "#" + v.ModDiscrim
+		}
+		out += fmt.Sprintf("**#%d** %s by %s: %s (%s)\n", v.CaseNumber, v.Action, mod, v.Reason, v.CreatedAt.UTC().Format(time.RFC822))
+	}
+	return out
 }
 
 var (
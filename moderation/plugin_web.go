@@ -9,10 +9,11 @@ import (
 	"golang.org/x/net/context"
 	"html/template"
 	"net/http"
+	"strconv"
 )
 
 func (p *Plugin) InitWeb() {
-	web.Templates = template.Must(web.Templates.ParseFiles("templates/plugins/moderation.html"))
+	web.Templates = template.Must(web.Templates.ParseFiles("templates/plugins/moderation.html", "templates/plugins/moderation_cases.html"))
 
 	subMux := goji.SubMux()
 	web.CPMux.Handle(pat.New("/moderation"), subMux)
@@ -31,6 +32,15 @@ func (p *Plugin) InitWeb() {
 	subMux.HandleC(pat.Get("/"), getHandler)
 	subMux.HandleC(pat.Post(""), postHandler)
 	subMux.HandleC(pat.Post("/"), postHandler)
+
+	casesHandler := web.ControllerHandler(HandleModerationCases, "cp_moderation_cases")
+	subMux.HandleC(pat.Get("/cases"), casesHandler)
+	subMux.HandleC(pat.Get("/cases/"), casesHandler)
+
+	// Kick and ban messages, previewed with a sample reason and duration
+	web.RegisterTemplatePreview("moderation", func(ctx *web.TemplatePreviewContext, src string) (string, error) {
+		return common.ParseExecuteTemplate(ctx.Guild.ID, src, DMTemplateData(ctx.Member.User, "Example reason", 60))
+	})
 }
 
 // The moderation page itself
@@ -63,3 +73,43 @@ func HandlePostModeration(ctx context.Context, w http.ResponseWriter, r *http.Re
 
 	return templateData, nil
 }
+
+// Lists the moderation cases on the server, optionally filtered by user
+func HandleModerationCases(ctx context.Context, w http.ResponseWriter, r *http.Request) (web.TemplateData, error) {
+	_, activeGuild, templateData := web.GetBaseCPContextData(ctx)
+
+	query := r.URL.Query()
+
+	userID := query.Get("user")
+	if userID != "" {
+		if _, err := strconv.ParseInt(userID, 10, 64); err != nil {
+			return templateData, web.NewPublicError("Invalid user id")
+		}
+	}
+	templateData["FilterUser"] = userID
+
+	var before, after int64
+	if beforeStr := query.Get("before"); beforeStr != "" {
+		before, _ = strconv.ParseInt(beforeStr, 10, 64)
+	} else {
+		templateData["FirstPage"] = true
+	}
+
+	if afterStr := query.Get("after"); afterStr != "" {
+		after, _ = strconv.ParseInt(afterStr, 10, 64)
+		templateData["FirstPage"] = false
+	}
+
+	cases, err := GetGuildCases(activeGuild.ID, userID, before, after, 25)
+	if err != nil {
+		return templateData, err
+	}
+
+	templateData["Cases"] = cases
+	if len(cases) > 0 {
+		templateData["Newest"] = cases[0].CaseNumber
+		templateData["Oldest"] = cases[len(cases)-1].CaseNumber
+	}
+
+	return templateData, nil
+}
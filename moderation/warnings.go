@@ -0,0 +1,169 @@
+package moderation
+
+import (
+	"fmt"
+	"github.com/fzzy/radix/redis"
+	"github.com/jinzhu/gorm"
+	"github.com/jonas747/discordgo"
+	"github.com/jonas747/yagpdb/bot"
+	"github.com/jonas747/yagpdb/common"
+	"strconv"
+	"time"
+)
+
+type WarningModel struct {
+	common.SmallModel
+
+	GuildID int64 `gorm:"index"`
+	UserID  int64 `gorm:"index"`
+
+	AuthorID       int64
+	AuthorUsername string
+
+	Message string
+}
+
+func (w *WarningModel) TableName() string {
+	return "moderation_warnings"
+}
+
+// Returns the query for the active (not expired) warnings of a user
+func activeWarningsQuery(config *Config, guildID, userID string) *gorm.DB {
+	q := common.SQL.Where("guild_id = ? AND user_id = ?", guildID, userID)
+	if config.WarnExpireDays > 0 {
+		q = q.Where("created_at > ?", time.Now().Add(-time.Hour*24*time.Duration(config.WarnExpireDays)))
+	}
+	return q
+}
+
+// GetWarnings returns the active warnings of the user, newest first
+func GetWarnings(config *Config, guildID, userID string) ([]*WarningModel, error) {
+	var result []*WarningModel
+	err := activeWarningsQuery(config, guildID, userID).Order("id desc").Find(&result).Error
+	if err == gorm.ErrRecordNotFound {
+		err = nil
+	}
+	return result, err
+}
+
+func NumActiveWarnings(config *Config, guildID, userID string) (int, error) {
+	count := 0
+	err := activeWarningsQuery(config, guildID, userID).Model(&WarningModel{}).Count(&count).Error
+	return count, err
+}
+
+// ClearWarnings removes all the warnings of a user, returns the number of warnings removed
+func ClearWarnings(guildID, userID string) (int64, error) {
+	result := common.SQL.Where("guild_id = ? AND user_id = ?", guildID, userID).Delete(WarningModel{})
+	return result.RowsAffected, result.Error
+}
+
+// DeleteWarning removes a single warning, returns false if it didn't exist
+func DeleteWarning(guildID string, id int) (bool, error) {
+	result := common.SQL.Where("guild_id = ? AND id = ?", guildID, id).Delete(WarningModel{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// WarnUser stores a warning, notifies the user and carries out punishments if any of the thresholds are reached
+func WarnUser(config *Config, client *redis.Client, guildID, channelID string, author *discordgo.User, target *discordgo.User, message string) error {
+	if config == nil {
+		var err error
+		config, err = GetConfig(guildID)
+		if err != nil {
+			return err
+		}
+	}
+
+	warning := &WarningModel{
+		GuildID:        common.MustParseInt(guildID),
+		UserID:         common.MustParseInt(target.ID),
+		AuthorUsername: author.Username + "#" + author.Discriminator,
+		Message:        message,
+	}
+	warning.AuthorID, _ = strconv.ParseInt(author.ID, 10, 64)
+
+	err := common.SQL.Create(warning).Error
+	if err != nil {
+		return err
+	}
+
+	guild := common.MustGetGuild(guildID)
+	bot.SendDM(common.BotSession, target.ID, "**"+guild.Name+":** You have been warned\n**Reason:** "+message)
+
+	logChannel := ""
+	if config.WarnSendToModlog {
+		logChannel = config.ActionChannel
+	}
+
+	err = logAction(guildID, logChannel, author, "Warned", target, message, "", 0)
+	if err != nil {
+		return err
+	}
+
+	return checkWarningThresholds(config, client, guildID, channelID, target)
+}
+
+// The punishment for reaching a warning threshold
+type warningThreshold int
+
+const (
+	warningThresholdNone warningThreshold = iota
+	warningThresholdMute
+	warningThresholdKick
+	warningThresholdBan
+)
+
+// Returns the threshold the user reached with num active warnings, highest punishment first
+// Only the warning that reaches a threshold triggers it, so further warnings don't repeat the same punishment
+func reachedWarningThreshold(config *Config, num int) warningThreshold {
+	switch {
+	case config.WarnBanAfter > 0 && num == config.WarnBanAfter:
+		return warningThresholdBan
+	case config.WarnKickAfter > 0 && num == config.WarnKickAfter:
+		return warningThresholdKick
+	case config.WarnMuteAfter > 0 && num == config.WarnMuteAfter:
+		return warningThresholdMute
+	}
+	return warningThresholdNone
+}
+
+// Punishes the user if they just reached one of the warning thresholds
+func checkWarningThresholds(config *Config, client *redis.Client, guildID, channelID string, target *discordgo.User) error {
+	if config.WarnMuteAfter < 1 && config.WarnKickAfter < 1 && config.WarnBanAfter < 1 {
+		return nil
+	}
+
+	num, err := NumActiveWarnings(config, guildID, target.ID)
+	if err != nil {
+		return err
+	}
+
+	author := common.BotSession.State.User.User
+	reason := fmt.Sprintf("Reached %d warnings", num)
+
+	switch reachedWarningThreshold(config, num) {
+	case warningThresholdBan:
+		return BanUser(config, guildID, channelID, author, reason, target)
+	case warningThresholdKick:
+		return KickUser(config, guildID, channelID, author, reason, target)
+	case warningThresholdMute:
+		member, err := common.GetGuildMember(common.BotSession, guildID, target.ID)
+		if err != nil {
+			return err
+		}
+
+		duration := config.WarnMuteDuration
+		if duration < 1 {
+			duration = 10
+		}
+
+		err = MuteUnmuteUser(config, client, true, guildID, channelID, author, reason, member, duration)
+		if err == ErrNoMuteRole {
+			// Nothing we can do about it
+			return nil
+		}
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,35 @@
+package moderation
+
+import (
+	"testing"
+)
+
+func TestReachedWarningThreshold(t *testing.T) {
+	cases := []struct {
+		name     string
+		mute     int
+		kick     int
+		ban      int
+		num      int
+		expected warningThreshold
+	}{
+		{"disabled", 0, 0, 0, 3, warningThresholdNone},
+		{"below", 3, 5, 7, 2, warningThresholdNone},
+		{"mute", 3, 5, 7, 3, warningThresholdMute},
+		{"between mute and kick", 3, 5, 7, 4, warningThresholdNone},
+		{"kick", 3, 5, 7, 5, warningThresholdKick},
+		{"ban", 3, 5, 7, 7, warningThresholdBan},
+		{"past ban", 3, 5, 7, 8, warningThresholdNone},
+		{"only kick", 0, 2, 0, 2, warningThresholdKick},
+		// The highest punishment wins when thresholds are the same
+		{"kick and ban", 0, 4, 4, 4, warningThresholdBan},
+		{"mute and kick", 4, 4, 0, 4, warningThresholdKick},
+	}
+
+	for _, c := range cases {
+		config := &Config{WarnMuteAfter: c.mute, WarnKickAfter: c.kick, WarnBanAfter: c.ban}
+		if got := reachedWarningThreshold(config, c.num); got != c.expected {
+			t.Errorf("%s: got %d, expected %d", c.name, got, c.expected)
+		}
+	}
+}
@@ -31,20 +31,14 @@ func HandleGuildMemberAdd(s *discordgo.Session, evt *discordgo.GuildMemberAdd, c
 		return
 	}
 
-	templateData := map[string]interface{}{
-		"user":   evt.User, // Deprecated
-		"User":   evt.User,
-		"guild":  guild, // Deprecated
-		"Guild":  guild,
-		"Server": guild,
-	}
+	templateData := TemplateData(guild, evt.User)
 
 	config := GetConfig(evt.GuildID)
 
 	// Beware of the pyramid and its curses
 	if config.JoinDMEnabled {
 
-		msg, err := common.ParseExecuteTemplate(config.JoinDMMsg, templateData)
+		msg, err := common.ParseExecuteTemplate(guild.ID, config.JoinDMMsg, templateData)
 		if err != nil {
 			log.WithError(err).WithField("guild", guild.ID).Error("Failed parsing/executing dm template")
 		} else {
@@ -62,7 +56,7 @@ func HandleGuildMemberAdd(s *discordgo.Session, evt *discordgo.GuildMemberAdd, c
 
 	if config.JoinServerEnabled {
 		channel := GetChannel(guild, config.JoinServerChannel)
-		msg, err := common.ParseExecuteTemplate(config.JoinServerMsg, templateData)
+		msg, err := common.ParseExecuteTemplate(guild.ID, config.JoinServerMsg, templateData)
 		if err != nil {
 			log.WithError(err).WithField("guild", guild.ID).Error("Failed parsing/executing join template")
 		} else {
@@ -71,6 +65,17 @@ func HandleGuildMemberAdd(s *discordgo.Session, evt *discordgo.GuildMemberAdd, c
 	}
 }
 
+// TemplateData returns the data the join and leave message templates are executed with
+func TemplateData(guild *discordgo.Guild, user *discordgo.User) map[string]interface{} {
+	return map[string]interface{}{
+		"user":   user, // Deprecated
+		"User":   user,
+		"guild":  guild, // Deprecated
+		"Guild":  guild,
+		"Server": guild,
+	}
+}
+
 func HandleGuildMemberRemove(s *discordgo.Session, evt *discordgo.GuildMemberRemove, client *redis.Client) {
 
 	guild, err := s.State.Guild(evt.GuildID)
@@ -79,13 +84,7 @@ func HandleGuildMemberRemove(s *discordgo.Session, evt *discordgo.GuildMemberRem
 		return // We can't process this then
 	}
 
-	templateData := map[string]interface{}{
-		"user":   evt.User, // Deprecated
-		"User":   evt.User,
-		"guild":  guild, // Deprecated
-		"Guild":  guild,
-		"Server": guild,
-	}
+	templateData := TemplateData(guild, evt.User)
 	config := GetConfig(evt.GuildID)
 
 	if !config.LeaveEnabled {
@@ -93,7 +92,7 @@ func HandleGuildMemberRemove(s *discordgo.Session, evt *discordgo.GuildMemberRem
 	}
 
 	channel := GetChannel(guild, config.LeaveChannel)
-	msg, err := common.ParseExecuteTemplate(config.LeaveMsg, templateData)
+	msg, err := common.ParseExecuteTemplate(guild.ID, config.LeaveMsg, templateData)
 	if err != nil {
 		log.WithError(err).WithField("guild", guild.ID).Error("Failed parsing/executing leave template")
 		return
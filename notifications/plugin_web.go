@@ -22,6 +22,10 @@ func (p *Plugin) InitWeb() {
 
 	web.CPMux.HandleC(pat.Post("/notifications/general"), web.RequireGuildChannelsMiddleware(postHandler))
 	web.CPMux.HandleC(pat.Post("/notifications/general/"), web.RequireGuildChannelsMiddleware(postHandler))
+
+	web.RegisterTemplatePreview("notification", func(ctx *web.TemplatePreviewContext, src string) (string, error) {
+		return common.ParseExecuteTemplate(ctx.Guild.ID, src, TemplateData(ctx.Guild, ctx.Member.User))
+	})
 }
 
 func HandleNotificationsGet(ctx context.Context, w http.ResponseWriter, r *http.Request) interface{} {
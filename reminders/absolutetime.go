@@ -0,0 +1,84 @@
+package reminders
+
+import (
+	"strings"
+	"time"
+)
+
+var absoluteTimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// parseAbsoluteTime parses times like "2026-12-01T09:00", "tomorrow 14:00", "friday 5pm" and "17:30" in the location of now.
+// Returns false if str isn't a absolute time, in which case it should be parsed as a relative one.
+func parseAbsoluteTime(str string, now time.Time) (time.Time, bool, error) {
+	str = strings.TrimSpace(str)
+	loc := now.Location()
+
+	for _, layout := range absoluteTimeLayouts {
+		t, err := time.ParseInLocation(layout, str, loc)
+		if err == nil {
+			return t, true, nil
+		}
+	}
+
+	lower := strings.ToLower(str)
+	lower = strings.Replace(lower, " at ", " ", 1)
+	fields := strings.Fields(lower)
+	if len(fields) < 1 {
+		return time.Time{}, false, nil
+	}
+
+	// Only a time of day, "14:00" or "5pm", the next time it's that time
+	if len(fields) == 1 && (strings.Contains(fields[0], ":") || strings.HasSuffix(fields[0], "am") || strings.HasSuffix(fields[0], "pm")) {
+		hour, minute, err := parseClock(fields[0])
+		if err != nil {
+			return now, true, err
+		}
+
+		t := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, loc)
+		if !t.After(now) {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, true, nil
+	}
+
+	// A day, optionally followed by a time of day, defaults to the current time of day
+	day := fields[0]
+	weekday, isWeekday := parseWeekday(day)
+	if day != "today" && day != "tomorrow" && !isWeekday {
+		// Not a day, "1h 30min" and such are relative times
+		return time.Time{}, false, nil
+	}
+
+	hour, minute := now.Hour(), now.Minute()
+	if len(fields) > 1 {
+		var err error
+		hour, minute, err = parseClock(strings.Join(fields[1:], ""))
+		if err != nil {
+			return now, true, err
+		}
+	}
+
+	switch day {
+	case "today":
+		return time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, loc), true, nil
+	case "tomorrow":
+		return time.Date(now.Year(), now.Month(), now.Day()+1, hour, minute, 0, 0, loc), true, nil
+	}
+
+	// The next time it's that day and time
+	for i := 0; i < 8; i++ {
+		t := time.Date(now.Year(), now.Month(), now.Day()+i, hour, minute, 0, 0, loc)
+		if t.Weekday() == weekday && t.After(now) {
+			return t, true, nil
+		}
+	}
+
+	return now, true, nil
+}
@@ -0,0 +1,87 @@
+package reminders
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseAbsoluteTime(t *testing.T) {
+	// testNow is a saturday at 09:03
+	cases := []struct {
+		str      string
+		expected time.Time
+	}{
+		{"2026-12-01T09:00", testDate(12, 1, 9, 0)},
+		{"2026-12-01 09:00", testDate(12, 1, 9, 0)},
+		{"2026-12-01", testDate(12, 1, 0, 0)},
+		{"2026-12-01T09:00:00+01:00", testDate(12, 1, 8, 0)},
+		{"17:30", testDate(10, 17, 17, 30)},
+		{"5pm", testDate(10, 17, 17, 0)},
+		// Already passed today
+		{"08:00", testDate(10, 18, 8, 0)},
+		{"today", testDate(10, 17, 9, 3)},
+		{"today 18:00", testDate(10, 17, 18, 0)},
+		{"tomorrow", testDate(10, 18, 9, 3)},
+		{"tomorrow 14:00", testDate(10, 18, 14, 0)},
+		{"Tomorrow at 2pm", testDate(10, 18, 14, 0)},
+		{"tomorrow 2 pm", testDate(10, 18, 14, 0)},
+		{"friday 5pm", testDate(10, 23, 17, 0)},
+		{"mon", testDate(10, 19, 9, 3)},
+		{"saturday 10:00", testDate(10, 17, 10, 0)},
+		// Already passed this saturday
+		{"saturday 8am", testDate(10, 24, 8, 0)},
+	}
+
+	for _, c := range cases {
+		got, isAbsolute, err := parseAbsoluteTime(c.str, testNow)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", c.str, err)
+			continue
+		}
+		if !isAbsolute {
+			t.Errorf("%q: expected an absolute time", c.str)
+			continue
+		}
+		if !got.Equal(c.expected) {
+			t.Errorf("%q: got %s, expected %s", c.str, got, c.expected)
+		}
+	}
+}
+
+func TestParseAbsoluteTimeRelative(t *testing.T) {
+	// These are relative times and should be left to the relative parser
+	cases := []string{"1h", "10m", "5", "1h 30min", "2 hours", "1 day 2 hours", "monkey 5pm", ""}
+
+	for _, str := range cases {
+		_, isAbsolute, err := parseAbsoluteTime(str, testNow)
+		if err != nil || isAbsolute {
+			t.Errorf("%q: expected a relative time, got absolute: %t, err: %v", str, isAbsolute, err)
+		}
+	}
+}
+
+func TestParseAbsoluteTimeErrors(t *testing.T) {
+	cases := []string{"tomorrow 25:00", "friday banana", "99:00", "13pm", "today 12:60"}
+
+	for _, str := range cases {
+		_, isAbsolute, err := parseAbsoluteTime(str, testNow)
+		if err == nil || !isAbsolute {
+			t.Errorf("%q: expected an invalid absolute time, got absolute: %t, err: %v", str, isAbsolute, err)
+		}
+	}
+}
+
+func TestParseAbsoluteTimeLocation(t *testing.T) {
+	loc := time.FixedZone("UTC+2", 2*60*60)
+	now := testNow.In(loc) // 11:03 there
+
+	got, _, err := parseAbsoluteTime("10:00", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := time.Date(2026, 10, 18, 10, 0, 0, 0, loc)
+	if !got.Equal(expected) {
+		t.Errorf("Got %s, expected %s", got, expected)
+	}
+}
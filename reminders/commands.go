@@ -27,7 +27,7 @@ var cmds = []commandsystem.CommandHandler{
 		Category: commands.CategoryTool,
 		SimpleCommand: &commandsystem.SimpleCommand{
 			Name:         "Remindme",
-			Description:  "Schedules a reminder, example: 'remindme 1h30min are you alive still?'",
+			Description:  "Schedules a reminder, example: 'remindme 1h30min are you alive still?', 'remindme \"tomorrow 14:00\" meeting' or a repeating one: 'remindme \"every day at 09:00\" stand-up'. Times are in your timezone, see settimezone",
 			Aliases:      []string{"remind"},
 			RequiredArgs: 2,
 			Arguments: []*commandsystem.ArgumentDef{
@@ -35,31 +35,21 @@ var cmds = []commandsystem.CommandHandler{
 				&commandsystem.ArgumentDef{Name: "Message", Type: commandsystem.ArgumentTypeString},
 			},
 		},
-		RunFunc: func(parsed *commandsystem.ParsedCommand, client *redis.Client, m *discordgo.MessageCreate) (interface{}, error) {
-			currentReminders, _ := GetUserReminders(m.Author.ID)
-			if len(currentReminders) >= 25 {
-				return "You can have a maximum of 25 active reminders, list your reminders with the `reminders` command", nil
-			}
-
-			when, err := parseReminderTime(parsed.Args[0].Str())
-			if err != nil {
-				return err, err
-			}
-
-			if when.After(time.Now().Add(time.Hour * 24 * 366)) {
-				return "Can be max 265 days from now...", nil
-			}
-
-			_, err = NewReminder(client, m.Author.ID, m.ChannelID, parsed.Args[1].Str(), when)
-			if err != nil {
-				return err, err
-			}
-
-			timeFromNow := humanize.Time(when)
-			tStr := when.Format(time.RFC822)
-
-			return "Set a reminder for " + timeFromNow + " from now (" + tStr + ")\nView reminders with the reminders command", nil
+		RunFunc: remindmeRunFunc(false),
+	},
+	&commands.CustomCommand{
+		Category: commands.CategoryTool,
+		SimpleCommand: &commandsystem.SimpleCommand{
+			Name:         "RemindmeDM",
+			Description:  "Same as remindme but the reminder is sent to you in a DM, example: 'remindmedm \"every monday at 8am\" weekly report'",
+			Aliases:      []string{"dmremind"},
+			RequiredArgs: 2,
+			Arguments: []*commandsystem.ArgumentDef{
+				&commandsystem.ArgumentDef{Name: "Time", Type: commandsystem.ArgumentTypeString},
+				&commandsystem.ArgumentDef{Name: "Message", Type: commandsystem.ArgumentTypeString},
+			},
 		},
+		RunFunc: remindmeRunFunc(true),
 	},
 	&commands.CustomCommand{
 		Category: commands.CategoryTool,
@@ -74,7 +64,7 @@ var cmds = []commandsystem.CommandHandler{
 			}
 
 			out := "Your reminders:\n"
-			out += stringReminders(common.BotSession.State, currentReminders, false)
+			out += stringReminders(common.BotSession.State, currentReminders, false, GetUserLocation(m.Author.ID))
 			out += "\nRemove a reminder with `delreminder/rmreminder (id)` where id is the first number for each reminder above"
 			return out, nil
 		},
@@ -100,11 +90,48 @@ var cmds = []commandsystem.CommandHandler{
 			}
 
 			out := "Reminders in this channel:\n"
-			out += stringReminders(common.BotSession.State, currentReminders, true)
+			out += stringReminders(common.BotSession.State, currentReminders, true, GetUserLocation(m.Author.ID))
 			out += "\nRemove a reminder with `delreminder/rmreminder (id)` where id is the first number for each reminder above"
 			return out, nil
 		},
 	},
+	&commands.CustomCommand{
+		Category: commands.CategoryTool,
+		SimpleCommand: &commandsystem.SimpleCommand{
+			Name:        "SetTimezone",
+			Aliases:     []string{"settz", "timezone"},
+			Description: "Sets your timezone used for reminders, example: 'settimezone Europe/Oslo', 'settimezone reset' goes back to UTC",
+			Arguments: []*commandsystem.ArgumentDef{
+				&commandsystem.ArgumentDef{Name: "Timezone", Type: commandsystem.ArgumentTypeString},
+			},
+		},
+		RunFunc: func(parsed *commandsystem.ParsedCommand, client *redis.Client, m *discordgo.MessageCreate) (interface{}, error) {
+			if parsed.Args[0] == nil {
+				loc := GetUserLocation(m.Author.ID)
+				return "Your timezone is `" + loc.String() + "`, the time there is " + time.Now().In(loc).Format(time.RFC822), nil
+			}
+
+			if strings.EqualFold(parsed.Args[0].Str(), "reset") {
+				err := RemoveUserTimezone(m.Author.ID)
+				if err != nil {
+					return "Failed resetting your timezone, contact bot owner", err
+				}
+				return "Reset your timezone to UTC", nil
+			}
+
+			loc, err := LoadTimezone(parsed.Args[0].Str())
+			if err != nil {
+				return err.Error(), nil
+			}
+
+			err = SetUserTimezone(m.Author.ID, loc)
+			if err != nil {
+				return "Failed setting your timezone, contact bot owner", err
+			}
+
+			return "Set your timezone to `" + loc.String() + "`, the time there is " + time.Now().In(loc).Format(time.RFC822), nil
+		},
+	},
 	&commands.CustomCommand{
 		Category: commands.CategoryTool,
 		SimpleCommand: &commandsystem.SimpleCommand{
@@ -140,46 +167,109 @@ var cmds = []commandsystem.CommandHandler{
 
 			// Do the actual deletion
 			err = common.SQL.Delete(reminder).Error
+			if err != nil {
+				return "Failed deleting reminder, contact bot owner", err
+			}
 
-			// Check if we should remove the scheduled event
-			currentReminders, err := GetUserReminders(reminder.UserID)
+			err = RemoveReminderEvent(client, reminder.ID)
 			if err != nil {
-				return "Failed fetching reminders, contact bot owner", err
+				return "Failed removing the scheduled reminder, contact bot owner", err
 			}
 
 			delMsg := fmt.Sprintf("Deleted reminder **#%d**: %q", reminder.ID, reminder.Message)
+			return delMsg, nil
+		},
+	},
+}
+
+func remindmeRunFunc(dm bool) func(parsed *commandsystem.ParsedCommand, client *redis.Client, m *discordgo.MessageCreate) (interface{}, error) {
+	return func(parsed *commandsystem.ParsedCommand, client *redis.Client, m *discordgo.MessageCreate) (interface{}, error) {
+		currentReminders, _ := GetUserReminders(m.Author.ID)
+		if len(currentReminders) >= 25 {
+			return "You can have a maximum of 25 active reminders, list your reminders with the `reminders` command", nil
+		}
+
+		timeStr := parsed.Args[0].Str()
+		repeat := ""
+
+		// Absolute times and repeats are in the users timezone
+		loc := GetUserLocation(m.Author.ID)
+		now := time.Now().In(loc)
+
+		var when time.Time
+		if IsRepeatExpression(timeStr) {
+			schedule, err := ParseRepeat(timeStr)
+			if err != nil {
+				return "Invalid repeat: " + err.Error(), nil
+			}
+			repeat = timeStr
+			when = schedule.Next(now)
+		} else {
+			var err error
+			var isAbsolute bool
+			when, isAbsolute, err = parseAbsoluteTime(timeStr, now)
+			if err != nil {
+				return "Invalid time: " + err.Error(), nil
+			}
 
-			// If there is another reminder with the same timestamp, do not remove the scheduled event
-			for _, v := range currentReminders {
-				if v.When == reminder.When {
-					return delMsg, nil
+			if !isAbsolute {
+				when, err = parseReminderTime(timeStr)
+				if err != nil {
+					return err, err
 				}
+			} else if !when.After(now) {
+				return "That time has already passed", nil
 			}
 
-			// No other reminder for this user at this timestamp, remove the scheduled event
-			common.RemoveScheduledEvent(client, fmt.Sprintf("reminders_check_user:%s", reminder.When), reminder.UserID)
+			if when.After(time.Now().Add(time.Hour * 24 * 366)) {
+				return "Can be max 265 days from now...", nil
+			}
+		}
 
-			return delMsg, nil
-		},
-	},
+		_, err := NewReminder(client, m.Author.ID, m.ChannelID, parsed.Args[1].Str(), when, repeat, dm)
+		if err != nil {
+			return err, err
+		}
+
+		timeFromNow := humanize.Time(when)
+		tStr := when.In(loc).Format(time.RFC822)
+
+		if repeat != "" {
+			return "Set a repeating reminder (" + repeat + "), the first one is " + timeFromNow + " (" + tStr + ")\nView reminders with the reminders command", nil
+		}
+		return "Set a reminder for " + timeFromNow + " from now (" + tStr + ")\nView reminders with the reminders command", nil
+	}
+}
+
+// Extra info about repeating and DM reminders when listing them
+func reminderFlags(r *Reminder) string {
+	out := ""
+	if r.Repeat != "" {
+		out += fmt.Sprintf(" (repeats: %s)", r.Repeat)
+	}
+	if r.DM {
+		out += " (DM)"
+	}
+	return out
 }
 
-func stringReminders(state *discordgo.State, reminders []*Reminder, displayUsernames bool) string {
+// Times are displayed in loc
+func stringReminders(state *discordgo.State, reminders []*Reminder, displayUsernames bool, loc *time.Location) string {
 	out := ""
 	for _, v := range reminders {
 		channel := common.MustGetChannel(v.ChannelID)
 
-		t := time.Unix(v.When, 0)
+		t := time.Unix(v.When, 0).In(loc)
 		timeFromNow := humanize.Time(t)
 		tStr := t.Format(time.RFC822)
 		if !displayUsernames {
-			out += fmt.Sprintf("**%d**: <#%s>: %q - %s from now (%s)\n", v.ID, channel.ID, v.Message, timeFromNow, tStr)
+			out += fmt.Sprintf("**%d**: <#%s>: %q - %s from now (%s)%s\n", v.ID, channel.ID, v.Message, timeFromNow, tStr, reminderFlags(v))
 		} else {
 			member, err := state.Member(channel.GuildID, v.UserID)
 			if err != nil {
 				panic(err)
 			}
-			out += fmt.Sprintf("**%d**: %s: %q - %s from now (%s)\n", v.ID, member.User.Username, v.Message, timeFromNow, tStr)
+			out += fmt.Sprintf("**%d**: %s: %q - %s from now (%s)%s\n", v.ID, member.User.Username, v.Message, timeFromNow, tStr, reminderFlags(v))
 		}
 	}
 	return out
@@ -1,6 +1,7 @@
 package reminders
 
 import (
+	"errors"
 	"github.com/Sirupsen/logrus"
 	"github.com/fzzy/radix/redis"
 	"github.com/jinzhu/gorm"
@@ -15,8 +16,10 @@ import (
 type Plugin struct{}
 
 func RegisterPlugin() {
+	common.RegisterScheduledEventHandler("reminder", reminderEvtHandler)
+	// Events scheduled before reminders had their own event
 	common.RegisterScheduledEventHandler("reminders_check_user", checkUserEvtHandler)
-	err := common.SQL.AutoMigrate(&Reminder{}).Error
+	err := common.SQL.AutoMigrate(&Reminder{}, &UserTimezone{}).Error
 	if err != nil {
 		panic(err)
 	}
@@ -35,28 +38,87 @@ type Reminder struct {
 	ChannelID string
 	Message   string
 	When      int64
+
+	// Repeat expression for repeating reminders, empty if it only triggers once
+	Repeat string
+	// Deliver the reminder by DM instead of in the channel
+	DM bool
 }
 
 func (r *Reminder) Trigger() error {
 	logrus.WithFields(logrus.Fields{"channel": r.ChannelID, "user": r.UserID, "message": r.Message}).Info("Triggered reminder")
 
-	_, err := common.BotSession.ChannelMessageSend(r.ChannelID, "**Reminder** <@"+r.UserID+">: "+r.Message)
+	var err error
+	if r.DM {
+		err = bot.SendDM(common.BotSession, r.UserID, "**Reminder:** "+r.Message)
+	} else {
+		_, err = common.BotSession.ChannelMessageSend(r.ChannelID, "**Reminder** <@"+r.UserID+">: "+r.Message)
+	}
+
 	if err != nil {
 		if _, ok := err.(*discordgo.RESTError); !ok {
 			// Reschedule if discord didnt respond with an error (i.e they being down or something)
 			return err
-		} else {
+		} else if r.Repeat == "" {
 			// Don't reschedule the event incase it was sent in a channel with no bot perms, or channel was deleted
 			logrus.WithError(err).WithField("channel", r.ChannelID).WithField("user", r.UserID).Warn("Discord wouldnt let us send a message in this channel to remind")
 			return nil
 		}
 	}
 
+	if r.Repeat != "" {
+		// Errors are not returned here as that would send the reminder again
+		err = r.ScheduleNext()
+		if err != nil {
+			logrus.WithError(err).WithField("reminder", r.ID).Error("Failed scheduling next repeat of reminder")
+			r.stopRepeating(err)
+		}
+		return nil
+	}
+
 	// remove the actual reminder
 	common.SQL.Delete(r)
 	return nil
 }
 
+// ScheduleNext schedules the next trigger of a repeating reminder
+func (r *Reminder) ScheduleNext() error {
+	schedule, err := ParseRepeat(r.Repeat)
+	if err != nil {
+		return err
+	}
+
+	next := schedule.Next(time.Now().In(GetUserLocation(r.UserID)))
+	if next.IsZero() {
+		return common.SQL.Delete(r).Error
+	}
+
+	r.When = next.Unix()
+	err = common.SQL.Model(r).Update("when", r.When).Error
+	if err != nil {
+		return err
+	}
+
+	client, err := common.RedisPool.Get()
+	if err != nil {
+		return err
+	}
+	defer common.RedisPool.Put(client)
+
+	_, err = common.ScheduleUniqueEvent(client, "reminder", reminderEvtKey(r.ID), &ReminderEvtData{ReminderID: r.ID}, next)
+	return err
+}
+
+// Removes a repeating reminder that couldn't be scheduled again, so it doesn't stay around without ever triggering
+func (r *Reminder) stopRepeating(reason error) {
+	err := common.SQL.Delete(r).Error
+	if err != nil {
+		logrus.WithError(err).WithField("reminder", r.ID).Error("Failed removing repeating reminder")
+	}
+
+	bot.SendDM(common.BotSession, r.UserID, "**Your repeating reminder was removed since the next repeat couldn't be scheduled:** "+reason.Error()+"\n**Reminder:** "+r.Message)
+}
+
 func GetUserReminders(userID string) (results []*Reminder, err error) {
 	err = common.SQL.Where(&Reminder{UserID: userID}).Find(&results).Error
 	if err == gorm.ErrRecordNotFound {
@@ -73,13 +135,16 @@ func GetChannelReminders(channel string) (results []*Reminder, err error) {
 	return
 }
 
-func NewReminder(client *redis.Client, userID string, channelID string, message string, when time.Time) (*Reminder, error) {
+// NewReminder creates and schedules a new reminder, repeat is the repeat expression for repeating reminders
+func NewReminder(client *redis.Client, userID string, channelID string, message string, when time.Time, repeat string, dm bool) (*Reminder, error) {
 	whenUnix := when.Unix()
 	reminder := &Reminder{
 		UserID:    userID,
 		ChannelID: channelID,
 		Message:   message,
 		When:      whenUnix,
+		Repeat:    repeat,
+		DM:        dm,
 	}
 
 	err := common.SQL.Create(reminder).Error
@@ -87,18 +152,67 @@ func NewReminder(client *redis.Client, userID string, channelID string, message
 		return nil, err
 	}
 
-	err = common.ScheduleEvent(client, "reminders_check_user:"+strconv.FormatInt(whenUnix, 10), userID, when)
+	_, err = common.ScheduleUniqueEvent(client, "reminder", reminderEvtKey(reminder.ID), &ReminderEvtData{ReminderID: reminder.ID}, when)
 	return reminder, err
 }
 
-func checkUserEvtHandler(evt string) error {
-	split := strings.Split(evt, ":")
+// RemoveReminderEvent removes the scheduled event of the reminder
+func RemoveReminderEvent(client *redis.Client, reminderID uint) error {
+	return common.RemoveUniqueScheduledEvent(client, "reminder", reminderEvtKey(reminderID))
+}
+
+func reminderEvtKey(reminderID uint) string {
+	return strconv.FormatUint(uint64(reminderID), 10)
+}
+
+type ReminderEvtData struct {
+	ReminderID uint `json:"reminder_id"`
+}
+
+func reminderEvtHandler(evt *common.ScheduledEvent) error {
+	var data ReminderEvtData
+	err := evt.DecodeData(&data)
+	if err != nil {
+		logrus.WithError(err).Error("Handled invalid reminder scheduled event")
+		return nil
+	}
+
+	var reminder Reminder
+	err = common.SQL.Where("id = ?", data.ReminderID).First(&reminder).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			// Deleted in the meantime
+			return nil
+		}
+		return err
+	}
+
+	return reminder.Trigger()
+}
+
+// Data of the legacy "reminders_check_user" events
+type checkUserEvtData struct {
+	UserID string
+}
+
+func (c *checkUserEvtData) ParseLegacy(data string) error {
+	split := strings.Split(data, ":")
 	if len(split) < 2 {
-		logrus.Error("Handled invalid check user scheduled event: ", evt)
+		return errors.New("Invalid check user event data: " + data)
+	}
+	c.UserID = split[1]
+	return nil
+}
+
+func checkUserEvtHandler(evt *common.ScheduledEvent) error {
+	var data checkUserEvtData
+	err := evt.DecodeData(&data)
+	if err != nil {
+		logrus.WithError(err).Error("Handled invalid check user scheduled event")
 		return nil
 	}
 
-	reminders, err := GetUserReminders(split[1])
+	reminders, err := GetUserReminders(data.UserID)
 	if err != nil {
 		return err
 	}
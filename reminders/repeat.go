@@ -0,0 +1,430 @@
+package reminders
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Repeating reminders can be created using either a simple "every ..." expression:
+//   every 2h, every 30min, every day at 09:00, every weekday at 8am, every monday, every mon,thu at 17:30
+// or a standard 5 field cron expression (minute hour day-of-month month day-of-week):
+//   0 9 * * 1-5
+
+// The minimum time between 2 repeats
+const MinRepeatInterval = time.Minute * 10
+
+var (
+	ErrRepeatTooOften = errors.New("Reminders can't repeat more often than every 10 minutes")
+)
+
+type RepeatSchedule interface {
+	// Next returns the first time the reminder should trigger after t, in the location of t
+	Next(t time.Time) time.Time
+}
+
+// IsRepeatExpression returns true if str looks like a repeat expression rather than a single time
+func IsRepeatExpression(str string) bool {
+	str = strings.ToLower(strings.TrimSpace(str))
+	if strings.HasPrefix(str, "every ") {
+		return true
+	}
+
+	fields := strings.Fields(str)
+	if len(fields) != 5 {
+		return false
+	}
+
+	for _, f := range fields {
+		if strings.Trim(f, "0123456789*/,-abcdefghijklmnopqrstuvwxyz") != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseRepeat parses a repeat expression and makes sure it doesn't repeat too often
+func ParseRepeat(str string) (RepeatSchedule, error) {
+	str = strings.ToLower(strings.TrimSpace(str))
+
+	var schedule RepeatSchedule
+	var err error
+	if strings.HasPrefix(str, "every ") {
+		schedule, err = parseEvery(strings.TrimSpace(str[len("every "):]))
+	} else {
+		schedule, err = parseCron(str)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkRepeatInterval(schedule, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	return schedule, nil
+}
+
+// Max number of consecutive repeats checked by checkRepeatInterval, enough to cover a full week of repeats every 10 minutes
+const maxCheckedRepeats = 1100
+
+// Makes sure none of the repeats in the year after start (or the first maxCheckedRepeats of them) are closer than MinRepeatInterval
+// Checking only the first 2 isn't enough, "0,5 9 * * *" created at 09:03 would only compare 09:05 to 09:00 the next day
+func checkRepeatInterval(schedule RepeatSchedule, start time.Time) error {
+	last := schedule.Next(start)
+	if last.IsZero() {
+		return errors.New("That never happens")
+	}
+
+	limit := start.AddDate(1, 0, 0)
+	for i := 0; i < maxCheckedRepeats && last.Before(limit); i++ {
+		next := schedule.Next(last)
+		if next.IsZero() {
+			break
+		}
+
+		if next.Sub(last) < MinRepeatInterval {
+			return ErrRepeatTooOften
+		}
+		last = next
+	}
+
+	return nil
+}
+
+// Repeats with a fixed interval
+type intervalSchedule time.Duration
+
+func (i intervalSchedule) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(i))
+}
+
+// Repeats on the specified weekdays at a specific time of day
+type weekdaySchedule struct {
+	Days   [7]bool
+	Hour   int
+	Minute int
+}
+
+func (w *weekdaySchedule) Next(t time.Time) time.Time {
+	for i := 0; i < 8; i++ {
+		d := time.Date(t.Year(), t.Month(), t.Day()+i, w.Hour, w.Minute, 0, 0, t.Location())
+		if w.Days[d.Weekday()] && d.After(t) {
+			return d
+		}
+	}
+
+	return time.Time{}
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// parseWeekday parses a weekday name, full or abbreviated
+func parseWeekday(str string) (time.Weekday, bool) {
+	if len(str) < 3 {
+		return 0, false
+	}
+
+	day, ok := weekdayNames[str[:3]]
+	if !ok {
+		return 0, false
+	}
+
+	// Make sure it's not something like "monkey"
+	full := strings.ToLower(day.String())
+	if !strings.HasPrefix(full, strings.TrimSuffix(str, "s")) {
+		return 0, false
+	}
+
+	return day, true
+}
+
+// Parses the part after "every"
+func parseEvery(str string) (RepeatSchedule, error) {
+	hour, minute := 0, 0
+	hasTime := false
+
+	if index := strings.LastIndex(str, " at "); index != -1 {
+		var err error
+		hour, minute, err = parseClock(str[index+4:])
+		if err != nil {
+			return nil, err
+		}
+		hasTime = true
+		str = strings.TrimSpace(str[:index])
+	}
+
+	schedule := &weekdaySchedule{Hour: hour, Minute: minute}
+
+	switch str {
+	case "day":
+		if !hasTime {
+			return intervalSchedule(time.Hour * 24), nil
+		}
+		for i := range schedule.Days {
+			schedule.Days[i] = true
+		}
+		return schedule, nil
+	case "weekday":
+		for i := time.Monday; i <= time.Friday; i++ {
+			schedule.Days[i] = true
+		}
+		return schedule, nil
+	case "weekend":
+		schedule.Days[time.Saturday] = true
+		schedule.Days[time.Sunday] = true
+		return schedule, nil
+	}
+
+	// List of weekdays, "monday", "mon,thu" or "monday and friday"
+	names := strings.FieldsFunc(strings.Replace(str, " and ", ",", -1), func(r rune) bool { return r == ',' || r == ' ' })
+	foundDays := len(names) > 0
+	for _, name := range names {
+		day, ok := parseWeekday(name)
+		if !ok {
+			foundDays = false
+			break
+		}
+		schedule.Days[day] = true
+	}
+	if foundDays {
+		return schedule, nil
+	}
+
+	if hasTime {
+		return nil, errors.New("Couldn't figure out what days '" + str + "' is")
+	}
+
+	// Interval, "2h", "30 minutes", "week"
+	str = strings.Replace(str, " ", "", -1)
+	numStr := strings.TrimRight(str, "abcdefghijklmnopqrstuvwxyz")
+	modifier := str[len(numStr):]
+	if numStr == "" {
+		numStr = "1"
+	}
+
+	d, err := parseDuration(numStr, modifier)
+	if err != nil {
+		return nil, err
+	}
+	if d <= 0 {
+		return nil, errors.New("Invalid interval")
+	}
+
+	return intervalSchedule(d), nil
+}
+
+// Parses a time of day like "09:00", "9", "5pm" or "5:30pm"
+func parseClock(str string) (hour, minute int, err error) {
+	str = strings.Replace(strings.ToLower(str), " ", "", -1)
+
+	pm := false
+	hasSuffix := false
+	if strings.HasSuffix(str, "pm") {
+		pm = true
+		hasSuffix = true
+		str = str[:len(str)-2]
+	} else if strings.HasSuffix(str, "am") {
+		hasSuffix = true
+		str = str[:len(str)-2]
+	}
+
+	split := strings.SplitN(str, ":", 2)
+	hour, err = strconv.Atoi(split[0])
+	if err != nil {
+		return 0, 0, errors.New("Invalid time of day '" + str + "'")
+	}
+	if len(split) > 1 {
+		minute, err = strconv.Atoi(split[1])
+		if err != nil {
+			return 0, 0, errors.New("Invalid time of day '" + str + "'")
+		}
+	}
+
+	if hasSuffix {
+		if hour < 1 || hour > 12 {
+			return 0, 0, errors.New("Invalid hour")
+		}
+		if hour == 12 {
+			hour = 0
+		}
+		if pm {
+			hour += 12
+		}
+	}
+
+	if hour < 0 || hour > 23 || minute < 0 || minute > 59 {
+		return 0, 0, errors.New("Invalid time of day")
+	}
+
+	return hour, minute, nil
+}
+
+// A standard 5 field cron expression
+type cronSchedule struct {
+	Minutes     [60]bool
+	Hours       [24]bool
+	DaysOfMonth [32]bool
+	Months      [13]bool
+	DaysOfWeek  [7]bool
+
+	// If either of the day fields is a "*", both has to match, otherwise either of them
+	DayOfMonthAny bool
+	DayOfWeekAny  bool
+}
+
+var monthNames = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+func parseCron(str string) (RepeatSchedule, error) {
+	fields := strings.Fields(str)
+	if len(fields) != 5 {
+		return nil, errors.New("Cron expressions needs 5 fields: minute hour day-of-month month day-of-week")
+	}
+
+	schedule := &cronSchedule{
+		DayOfMonthAny: fields[2] == "*",
+		DayOfWeekAny:  fields[4] == "*",
+	}
+
+	err := parseCronField(fields[0], 0, 59, nil, schedule.Minutes[:])
+	if err == nil {
+		err = parseCronField(fields[1], 0, 23, nil, schedule.Hours[:])
+	}
+	if err == nil {
+		err = parseCronField(fields[2], 1, 31, nil, schedule.DaysOfMonth[:])
+	}
+	if err == nil {
+		err = parseCronField(fields[3], 1, 12, monthNames, schedule.Months[:])
+	}
+	if err == nil {
+		// 7 is also sunday
+		var days [8]bool
+		dayNames := make(map[string]int)
+		for k, v := range weekdayNames {
+			dayNames[k] = int(v)
+		}
+		err = parseCronField(fields[4], 0, 7, dayNames, days[:])
+		copy(schedule.DaysOfWeek[:], days[:7])
+		schedule.DaysOfWeek[0] = schedule.DaysOfWeek[0] || days[7]
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return schedule, nil
+}
+
+// Parses a single cron field like "*", "*/15", "1-5", "mon-fri" or "0,30" and sets the matching values in dst
+func parseCronField(field string, min, max int, names map[string]int, dst []bool) error {
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if index := strings.Index(part, "/"); index != -1 {
+			var err error
+			step, err = strconv.Atoi(part[index+1:])
+			if err != nil || step < 1 {
+				return errors.New("Invalid step in '" + field + "'")
+			}
+			part = part[:index]
+		}
+
+		start, end := min, max
+		if part != "*" {
+			rangeSplit := strings.SplitN(part, "-", 2)
+
+			var err error
+			start, err = parseCronValue(rangeSplit[0], names)
+			if err != nil {
+				return err
+			}
+			end = start
+			if len(rangeSplit) > 1 {
+				end, err = parseCronValue(rangeSplit[1], names)
+				if err != nil {
+					return err
+				}
+			} else if step > 1 {
+				// "5/10" means starting at 5
+				end = max
+			}
+		}
+
+		if start < min || end > max || start > end {
+			return errors.New("Out of range value in '" + field + "'")
+		}
+
+		for i := start; i <= end; i += step {
+			dst[i] = true
+		}
+	}
+
+	return nil
+}
+
+func parseCronValue(str string, names map[string]int) (int, error) {
+	if v, ok := names[str]; ok {
+		return v, nil
+	}
+
+	v, err := strconv.Atoi(str)
+	if err != nil {
+		return 0, errors.New("Invalid value '" + str + "'")
+	}
+	return v, nil
+}
+
+func (c *cronSchedule) dayMatches(t time.Time) bool {
+	domMatch := c.DaysOfMonth[t.Day()]
+	dowMatch := c.DaysOfWeek[t.Weekday()]
+
+	if c.DayOfMonthAny || c.DayOfWeekAny {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+func (c *cronSchedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1, 0, 0, loc)
+
+	// Give up after 5 years, for things like the 31st of february
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if !c.Months[t.Month()] {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+
+		if !c.Hours[t.Hour()] {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+
+		if !c.Minutes[t.Minute()] {
+			t = t.Add(time.Minute)
+			continue
+		}
+
+		return t
+	}
+
+	return time.Time{}
+}
@@ -0,0 +1,141 @@
+package reminders
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// A saturday
+var testNow = time.Date(2026, 10, 17, 9, 3, 0, 0, time.UTC)
+
+func testDate(month time.Month, day, hour, minute int) time.Time {
+	return time.Date(2026, month, day, hour, minute, 0, 0, time.UTC)
+}
+
+func TestRepeatSchedules(t *testing.T) {
+	cases := []struct {
+		expr   string
+		first  time.Time
+		second time.Time
+	}{
+		{"every 2h", testDate(10, 17, 11, 3), testDate(10, 17, 13, 3)},
+		{"every 30min", testDate(10, 17, 9, 33), testDate(10, 17, 10, 3)},
+		{"every day", testDate(10, 18, 9, 3), testDate(10, 19, 9, 3)},
+		{"every week", testDate(10, 24, 9, 3), testDate(10, 31, 9, 3)},
+		{"every day at 09:00", testDate(10, 18, 9, 0), testDate(10, 19, 9, 0)},
+		{"every weekday at 8am", testDate(10, 19, 8, 0), testDate(10, 20, 8, 0)},
+		{"every weekend at 10:00", testDate(10, 17, 10, 0), testDate(10, 18, 10, 0)},
+		{"every mon,thu at 17:30", testDate(10, 19, 17, 30), testDate(10, 22, 17, 30)},
+		{"every monday and friday", testDate(10, 19, 0, 0), testDate(10, 23, 0, 0)},
+		{"every sunday at 5:30pm", testDate(10, 18, 17, 30), testDate(10, 25, 17, 30)},
+
+		{"0 9 * * 1-5", testDate(10, 19, 9, 0), testDate(10, 20, 9, 0)},
+		{"*/15 * * * *", testDate(10, 17, 9, 15), testDate(10, 17, 9, 30)},
+		{"5/20 * * * *", testDate(10, 17, 9, 5), testDate(10, 17, 9, 25)},
+		{"30 8 1 * *", testDate(11, 1, 8, 30), testDate(12, 1, 8, 30)},
+		{"0 12 * * sun", testDate(10, 18, 12, 0), testDate(10, 25, 12, 0)},
+		{"0 0 * * 7", testDate(10, 18, 0, 0), testDate(10, 25, 0, 0)},
+		{"0 0 1 jan *", time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2028, 1, 1, 0, 0, 0, 0, time.UTC)},
+		// Either the day of month or the day of week has to match when both are set
+		{"0 9 13 * fri", testDate(10, 23, 9, 0), testDate(10, 30, 9, 0)},
+	}
+
+	for _, c := range cases {
+		schedule, err := ParseRepeat(c.expr)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", c.expr, err)
+			continue
+		}
+
+		first := schedule.Next(testNow)
+		second := schedule.Next(first)
+		if !first.Equal(c.first) || !second.Equal(c.second) {
+			t.Errorf("%q: got %s and %s, expected %s and %s", c.expr, first, second, c.first, c.second)
+		}
+	}
+}
+
+func TestParseRepeatErrors(t *testing.T) {
+	cases := []string{
+		"every",
+		"every 0h",
+		"every blursday at 9",
+		"every day at 25:00",
+		"every day at 13pm",
+		"61 * * * *",
+		"* * *",
+		"0 9 * * mon-",
+		"*/0 * * * *",
+		"0 9 5-1 * *",
+		// Never happens
+		"0 0 30 2 *",
+	}
+
+	for _, expr := range cases {
+		if _, err := ParseRepeat(expr); err == nil {
+			t.Errorf("%q: expected an error", expr)
+		}
+	}
+}
+
+func TestCheckRepeatInterval(t *testing.T) {
+	cases := []struct {
+		expr     string
+		tooOften bool
+	}{
+		{"every 10min", false},
+		{"every 5min", true},
+		{"*/10 * * * *", false},
+		{"*/5 * * * *", true},
+		{"0 9 * * *", false},
+		// Only too often once a day, created after 09:00 so the first 2 repeats are a day apart
+		{"0,5 9 * * *", true},
+		// Only too often once a month
+		{"0,5 9 1 * *", true},
+		{"0,30 * * * *", false},
+	}
+
+	for _, c := range cases {
+		var schedule RepeatSchedule
+		var err error
+		if strings.HasPrefix(c.expr, "every ") {
+			schedule, err = parseEvery(c.expr[len("every "):])
+		} else {
+			schedule, err = parseCron(c.expr)
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", c.expr, err)
+			continue
+		}
+
+		err = checkRepeatInterval(schedule, testNow)
+		if c.tooOften && err != ErrRepeatTooOften {
+			t.Errorf("%q: expected ErrRepeatTooOften, got %v", c.expr, err)
+		} else if !c.tooOften && err != nil {
+			t.Errorf("%q: unexpected error: %s", c.expr, err)
+		}
+	}
+}
+
+func TestIsRepeatExpression(t *testing.T) {
+	cases := []struct {
+		str      string
+		expected bool
+	}{
+		{"every 2h", true},
+		{"Every monday at 9", true},
+		{"0 9 * * 1-5", true},
+		{"*/15 * * * *", true},
+		{"1h", false},
+		{"tomorrow 14:00", false},
+		{"in 2 hours", false},
+		{"1h 2h 3h 4h 5h?", false},
+	}
+
+	for _, c := range cases {
+		if got := IsRepeatExpression(c.str); got != c.expected {
+			t.Errorf("IsRepeatExpression(%q) = %t, expected %t", c.str, got, c.expected)
+		}
+	}
+}
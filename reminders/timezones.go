@@ -0,0 +1,86 @@
+package reminders
+
+import (
+	"errors"
+	"github.com/jinzhu/gorm"
+	"github.com/jonas747/yagpdb/common"
+	"strings"
+	"time"
+)
+
+// The IANA timezone of a user, absolute reminder times are read in and displayed in it
+type UserTimezone struct {
+	UserID    string `gorm:"primary_key"`
+	Timezone  string
+	UpdatedAt time.Time
+}
+
+func (u *UserTimezone) TableName() string {
+	return "reminders_user_timezones"
+}
+
+// GetUserLocation returns the location of the users timezone, or UTC if they haven't set one
+func GetUserLocation(userID string) *time.Location {
+	var tz UserTimezone
+	err := common.SQL.Where("user_id = ?", userID).First(&tz).Error
+	if err != nil {
+		return time.UTC
+	}
+
+	loc, err := time.LoadLocation(tz.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// SetUserTimezone stores the users timezone, use LoadTimezone to get the location from a name
+func SetUserTimezone(userID string, loc *time.Location) error {
+	return common.SQL.Save(&UserTimezone{UserID: userID, Timezone: loc.String()}).Error
+}
+
+// RemoveUserTimezone resets the user back to UTC
+func RemoveUserTimezone(userID string) error {
+	err := common.SQL.Where("user_id = ?", userID).Delete(UserTimezone{}).Error
+	if err == gorm.ErrRecordNotFound {
+		err = nil
+	}
+	return err
+}
+
+// LoadTimezone loads a IANA timezone like "Europe/Oslo", case insensitive for the common forms
+func LoadTimezone(name string) (*time.Location, error) {
+	name = strings.TrimSpace(name)
+
+	// "Local" is the timezone of the server, which isn't very useful
+	if name == "" || strings.EqualFold(name, "local") {
+		return nil, errors.New("Unknown timezone")
+	}
+
+	if strings.EqualFold(name, "utc") || strings.EqualFold(name, "gmt") {
+		return time.UTC, nil
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err == nil {
+		return loc, nil
+	}
+
+	// Try "europe/oslo" -> "Europe/Oslo" and "america/new_york" -> "America/New_York"
+	parts := strings.Split(name, "/")
+	for i, p := range parts {
+		words := strings.Split(strings.ToLower(p), "_")
+		for j, w := range words {
+			if w != "" {
+				words[j] = strings.ToUpper(w[:1]) + w[1:]
+			}
+		}
+		parts[i] = strings.Join(words, "_")
+	}
+
+	loc, err = time.LoadLocation(strings.Join(parts, "/"))
+	if err != nil {
+		return nil, errors.New("Unknown timezone, use a name from the tz database like `Europe/Oslo` or `America/New_York`")
+	}
+	return loc, nil
+}
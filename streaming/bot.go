@@ -230,16 +230,7 @@ func SendStreamingAnnouncement(config *Config, guild *discordgo.Guild, member *d
 		return
 	}
 
-	templateData := map[string]interface{}{
-		"user":   member.User,
-		"User":   member.User,
-		"Server": guild,
-		"server": guild,
-		"URL":    p.Game.URL,
-		"url":    p.Game.URL,
-	}
-
-	out, err := common.ParseExecuteTemplate(config.AnnounceMessage, templateData)
+	out, err := common.ParseExecuteTemplate(guild.ID, config.AnnounceMessage, AnnounceTemplateData(guild, member.User, p.Game.URL))
 	if err != nil {
 		log.WithError(err).Error("Failed executing template")
 		return
@@ -248,6 +239,18 @@ func SendStreamingAnnouncement(config *Config, guild *discordgo.Guild, member *d
 	common.BotSession.ChannelMessageSend(config.AnnounceChannel, out)
 }
 
+// AnnounceTemplateData returns the data the announce message template is executed with
+func AnnounceTemplateData(guild *discordgo.Guild, user *discordgo.User, url string) map[string]interface{} {
+	return map[string]interface{}{
+		"user":   user,
+		"User":   user,
+		"Server": guild,
+		"server": guild,
+		"URL":    url,
+		"url":    url,
+	}
+}
+
 func GiveStreamingRole(member *discordgo.Member, role string, guild *discordgo.Guild) {
 	// Ensure the role exists
 	found := false
@@ -39,6 +39,10 @@ func (p *Plugin) InitWeb() {
 
 	streamingMux.HandleC(pat.Post(""), web.FormParserMW(web.RenderHandler(HandlePostStreaming, "cp_streaming"), Config{}))
 	streamingMux.HandleC(pat.Post("/"), web.FormParserMW(web.RenderHandler(HandlePostStreaming, "cp_streaming"), Config{}))
+
+	web.RegisterTemplatePreview("streaming", func(ctx *web.TemplatePreviewContext, src string) (string, error) {
+		return common.ParseExecuteTemplate(ctx.Guild.ID, src, AnnounceTemplateData(ctx.Guild, ctx.Member.User, "https://www.twitch.tv/example"))
+	})
 }
 
 // Adds the current config to the context
@@ -68,6 +68,8 @@ func BaseTemplateDataMiddleware(inner goji.Handler) goji.Handler {
 			"ClientID": common.Conf.ClientID,
 			"Host":     common.Conf.Host,
 			"Version":  common.VERSION,
+			// For the template function list in the template help
+			"TemplateFuncs": common.TemplateFuncDocs(),
 		}
 		inner.ServeHTTPC(SetContextTemplateData(ctx, baseData), w, r)
 	}
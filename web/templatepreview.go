@@ -0,0 +1,113 @@
+package web
+
+// Template previews, lets admins see what a template field renders to before saving it
+
+import (
+	"github.com/fzzy/radix/redis"
+	"github.com/jonas747/discordgo"
+	"github.com/jonas747/yagpdb/common"
+	"golang.org/x/net/context"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// TemplatePreviewContext is the data a template is previewed against
+type TemplatePreviewContext struct {
+	Client *redis.Client
+	Guild  *discordgo.Guild
+	// The member the template is rendered for, either the one requested or the user viewing the control panel
+	Member *discordgo.Member
+	// Optional channel id, may be empty
+	ChannelID string
+	// Optional sample arguments, for custom commands
+	Args []string
+}
+
+// TemplatePreviewFunc renders src against the preview context, it must not have any side effects
+type TemplatePreviewFunc func(ctx *TemplatePreviewContext, src string) (string, error)
+
+var templatePreviewers = make(map[string]TemplatePreviewFunc)
+
+// RegisterTemplatePreview registers a preview renderer for a kind of template field, should be called in InitWeb
+func RegisterTemplatePreview(kind string, f TemplatePreviewFunc) {
+	templatePreviewers[kind] = f
+}
+
+// TemplatePreviewResult is the json response of the preview endpoint
+type TemplatePreviewResult struct {
+	Output string `json:"output"`
+	Error  string `json:"error,omitempty"`
+
+	// Position of the error in the template source, 0 if unknown
+	Line   int `json:"line,omitempty"`
+	Column int `json:"column,omitempty"`
+}
+
+// Parse errors are in the form "template: name:line: msg" and exec errors "template: name:line:col: msg"
+var templateErrPosRegex = regexp.MustCompile(`^template: [^:]*:(\d+)(?::(\d+))?:`)
+
+// TemplateErrorPosition returns the line and column of a text/template parse or exec error, 0 if unknown
+func TemplateErrorPosition(err error) (line, column int) {
+	matches := templateErrPosRegex.FindStringSubmatch(err.Error())
+	if matches == nil {
+		return 0, 0
+	}
+
+	line, _ = strconv.Atoi(matches[1])
+	if matches[2] != "" {
+		column, _ = strconv.Atoi(matches[2])
+	}
+	return
+}
+
+// HandleTemplatePreview renders the "template" form value with the renderer registered for "kind"
+// Optional form values: "user" (id of a member to render for), "channel" and "args" (space separated)
+func HandleTemplatePreview(ctx context.Context, w http.ResponseWriter, r *http.Request) interface{} {
+	client, activeGuild, _ := GetBaseCPContextData(ctx)
+
+	previewer, ok := templatePreviewers[r.FormValue("kind")]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return &TemplatePreviewResult{Error: "Unknown template kind"}
+	}
+
+	member, err := templatePreviewMember(ctx, activeGuild.ID, r.FormValue("user"))
+	if err != nil {
+		return &TemplatePreviewResult{Error: "Failed retrieving member: " + err.Error()}
+	}
+
+	previewCtx := &TemplatePreviewContext{
+		Client:    client,
+		Guild:     activeGuild,
+		Member:    member,
+		ChannelID: r.FormValue("channel"),
+		Args:      strings.Fields(r.FormValue("args")),
+	}
+
+	out, err := previewer(previewCtx, r.FormValue("template"))
+	result := &TemplatePreviewResult{Output: out}
+	if err != nil {
+		result.Error = err.Error()
+		result.Line, result.Column = TemplateErrorPosition(err)
+	}
+
+	return result
+}
+
+// Returns the member with userID, or the current user if userID is empty
+func templatePreviewMember(ctx context.Context, guildID, userID string) (*discordgo.Member, error) {
+	if userID != "" {
+		// Only members of the server can be looked up
+		return common.GetGuildMember(common.BotSession, guildID, userID)
+	}
+
+	user := ctx.Value(common.ContextKeyUser).(*discordgo.User)
+	member, err := common.GetGuildMember(common.BotSession, guildID, user.ID)
+	if err != nil {
+		// Still preview for the user even if they can't be found in the server
+		return &discordgo.Member{GuildID: guildID, User: user}, nil
+	}
+	return member, nil
+}
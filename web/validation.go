@@ -13,6 +13,9 @@ package web
 // regex string: `valid:"regex,{maxLen}"`
 //    - Makes sure the string is shorter than maxLen
 //    - Makes sure the regex compiles without errors
+// regex lines string: `valid:"regexlines,{maxLen}"`
+//    - Makes sure the string is shorter than maxLen
+//    - Makes sure every non empty line compiles as a regex
 // template string: `valid:"tmpl,{maxLen}"`
 //    - Makes sure the string is shorter than maxLen)
 //    - Makes sure the templates parses without errors
@@ -31,6 +34,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"text/template"
 	"unicode"
 	"unicode/utf8"
 )
@@ -124,7 +128,13 @@ func ValidateForm(guild *discordgo.Guild, tmpl TemplateData, form interface{}) b
 		default:
 			// Recurse if it's another struct
 			switch tField.Type.Kind() {
-			case reflect.Struct, reflect.Ptr:
+			case reflect.Ptr:
+				// Not present in the form
+				if vField.IsNil() {
+					break
+				}
+				fallthrough
+			case reflect.Struct:
 				innerOk := ValidateForm(guild, tmpl, vField.Interface())
 				if !innerOk {
 					ok = false
@@ -193,13 +203,33 @@ func ValidateRegexField(s string, max int) error {
 	return nil
 }
 
+// ValidateRegexLinesField validates a field with one regex per line, empty lines are ignored
+func ValidateRegexLinesField(s string, max int) error {
+	if utf8.RuneCountInString(s) > max {
+		return fmt.Errorf("Too long (max %d)", max)
+	}
+
+	for i, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		_, err := regexp.Compile(line)
+		if err != nil {
+			return fmt.Errorf("Line %d: %s", i+1, err.Error())
+		}
+	}
+	return nil
+}
+
 func ValidateStringField(s string, tags *ValidationTag, guild *discordgo.Guild) error {
 	maxLen := 2000
 
 	kind, _ := tags.Str(0)
 
 	// Retrieve max len from tag is needed
-	if kind == "template" || kind == "regex" || kind == "" {
+	if kind == "template" || kind == "regex" || kind == "regexlines" || kind == "" {
 
 		m, ok := tags.Int(1)
 		if ok {
@@ -222,6 +252,8 @@ func ValidateStringField(s string, tags *ValidationTag, guild *discordgo.Guild)
 		err = ValidateTemplateField(s, maxLen)
 	case "regex":
 		err = ValidateRegexField(s, maxLen)
+	case "regexlines":
+		err = ValidateRegexLinesField(s, maxLen)
 	case "role":
 		err = ValidateRoleField(s, guild.Roles, allowEmpty)
 	case "channel":
@@ -260,7 +292,8 @@ func ValidateTemplateField(s string, max int) error {
 		return fmt.Errorf("Too long (max %d)", max)
 	}
 
-	_, err := common.ParseExecuteTemplate(s, nil)
+	// Only parsed, executing it without the real data would fail on things like lookups returning nil
+	_, err := template.New("").Funcs(common.TemplateFuncs("")).Parse(s)
 	return err
 }
 
@@ -157,6 +157,7 @@ func setupRoutes() *goji.Mux {
 
 	serverCpMuxer.HandleC(pat.Get("/cplogs"), RenderHandler(HandleCPLogs, "cp_action_logs"))
 	serverCpMuxer.HandleC(pat.Get("/cplogs/"), RenderHandler(HandleCPLogs, "cp_action_logs"))
+	serverCpMuxer.HandleC(pat.Post("/templatepreview"), APIHandler(HandleTemplatePreview))
 	CPMux = serverCpMuxer
 
 	for _, plugin := range Plugins {